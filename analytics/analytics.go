@@ -0,0 +1,218 @@
+// Package analytics records redirects of the shortened urls and aggregates them into click counters
+package analytics
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+)
+
+const (
+	defaultBufferSize    = 4096
+	defaultFlushInterval = 10 * time.Second
+	flushTimeout         = 5 * time.Second
+)
+
+// Event is a single redirect of a shortened url, it is written as a JSON line to the event log of the Recorder
+type Event struct {
+	Time      time.Time `json:"time"`
+	Key       string    `json:"key"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	// ClientIP has to be anonymized, see AnonymizeIP
+	ClientIP  string `json:"client_ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Stats are the aggregated click counters of a shortened url
+type Stats struct {
+	Total  int64
+	Hourly []model.ClickCount
+	Daily  []model.ClickCount
+}
+
+type bucket struct {
+	key         string
+	granularity string
+	start       int64
+}
+
+// Recorder aggregates events in memory and periodically flushes the counters to a persist.StatsStore,
+// the events themselves are appended to its event log if it has one
+// Record never blocks, events are dropped when the buffer is full
+type Recorder struct {
+	store    persist.StatsStore
+	events   chan Event
+	interval time.Duration
+	dropped  uint64
+	log      *bufio.Writer
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// NewRecorder creates a recorder and starts its worker, Close has to be called to flush the pending counters
+// bufferSize and flushInterval are defaulted if not positive, events are only counted if eventLog is nil
+func NewRecorder(store persist.StatsStore, bufferSize int, flushInterval time.Duration, eventLog io.Writer) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	r := &Recorder{
+		store:    store,
+		events:   make(chan Event, bufferSize),
+		interval: flushInterval,
+		done:     make(chan struct{}),
+	}
+	if eventLog != nil {
+		r.log = bufio.NewWriter(eventLog)
+	}
+	go r.run()
+	return r
+}
+
+// Record queues e to be aggregated
+func (r *Recorder) Record(e Event) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.events <- e:
+	default:
+		atomic.AddUint64(&r.dropped, 1)
+	}
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (r *Recorder) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// Close stops accepting events and flushes the pending counters and events, the event log is not closed
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.events)
+	r.mu.Unlock()
+
+	<-r.done
+}
+
+// Stats returns the click counters of key
+func (r *Recorder) Stats(ctx context.Context, key string) (Stats, error) {
+	counts, err := r.store.Clicks(ctx, key)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var s Stats
+	for _, c := range counts {
+		if c.Granularity == model.Daily {
+			s.Total += c.Count
+			s.Daily = append(s.Daily, c)
+		} else {
+			s.Hourly = append(s.Hourly, c)
+		}
+	}
+	return s, nil
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var enc *json.Encoder
+	if r.log != nil {
+		enc = json.NewEncoder(r.log)
+	}
+
+	pending := map[bucket]int64{}
+	for {
+		select {
+		case e, ok := <-r.events:
+			if !ok {
+				r.flush(pending)
+				r.flushLog()
+				return
+			}
+			if enc != nil {
+				// a failed write sticks to the buffer, it is reported by flushLog
+				_ = enc.Encode(e)
+			}
+			for _, gran := range []string{model.Hourly, model.Daily} {
+				pending[bucket{key: e.Key, granularity: gran, start: model.BucketStart(e.Time, gran).Unix()}]++
+			}
+		case <-ticker.C:
+			r.flush(pending)
+			r.flushLog()
+			pending = map[bucket]int64{}
+		}
+	}
+}
+
+func (r *Recorder) flushLog() {
+	if r.log == nil {
+		return
+	}
+	if err := r.log.Flush(); err != nil {
+		log.Errorf("analytics event log: %v", err)
+	}
+}
+
+func (r *Recorder) flush(pending map[bucket]int64) {
+	if len(pending) == 0 {
+		return
+	}
+
+	byKey := map[string][]model.ClickCount{}
+	for b, n := range pending {
+		byKey[b.key] = append(byKey[b.key], model.ClickCount{
+			Granularity: b.granularity,
+			Start:       time.Unix(b.start, 0).UTC(),
+			Count:       n,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	for key, counts := range byKey {
+		if err := r.store.IncrClicks(ctx, key, counts); err != nil {
+			log.Errorf("analytics flush of %s: %v", key, err)
+		}
+	}
+}
+
+// AnonymizeIP masks the host part of an IP address, keeping the /24 of IPv4 and the /48 of IPv6 addresses
+// it returns an empty string if ip can't be parsed
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,145 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+type fakeStore struct {
+	mu     sync.Mutex
+	counts map[string][]model.ClickCount
+}
+
+func (f *fakeStore) IncrClicks(_ context.Context, key string, counts []model.ClickCount) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range counts {
+		merged := false
+		for i, existing := range f.counts[key] {
+			if existing.Granularity == c.Granularity && existing.Start.Equal(c.Start) {
+				f.counts[key][i].Count += c.Count
+				merged = true
+			}
+		}
+		if !merged {
+			f.counts[key] = append(f.counts[key], c)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) Clicks(_ context.Context, key string) ([]model.ClickCount, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]model.ClickCount(nil), f.counts[key]...), nil
+}
+
+func TestRecorder(t *testing.T) {
+	store := &fakeStore{counts: map[string][]model.ClickCount{}}
+	rec := NewRecorder(store, 0, time.Hour, nil)
+
+	day := time.Date(2022, 7, 12, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Key: "A", Time: day.Add(time.Hour + time.Minute)},
+		{Key: "A", Time: day.Add(time.Hour + 30*time.Minute)},
+		{Key: "A", Time: day.Add(5 * time.Hour)},
+		{Key: "B", Time: day.Add(time.Hour)},
+	}
+	for _, e := range events {
+		rec.Record(e)
+	}
+	rec.Close()
+	// recording after close is a no-op
+	rec.Record(Event{Key: "A", Time: day})
+
+	stats, err := rec.Stats(context.Background(), "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 3 {
+		t.Fatalf("expecting total of 3, got: %d", stats.Total)
+	}
+	if len(stats.Daily) != 1 || !stats.Daily[0].Start.Equal(day) {
+		t.Fatalf("expecting a single daily bucket, got: %v", stats.Daily)
+	}
+	if len(stats.Hourly) != 2 {
+		t.Fatalf("expecting two hourly buckets, got: %v", stats.Hourly)
+	}
+	for _, h := range stats.Hourly {
+		if h.Start.Equal(day.Add(time.Hour)) && h.Count != 2 {
+			t.Fatalf("expecting 2 clicks in the first hour, got: %d", h.Count)
+		}
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	store := &fakeStore{counts: map[string][]model.ClickCount{}}
+	var buf bytes.Buffer
+	rec := NewRecorder(store, 0, time.Hour, &buf)
+
+	at := time.Date(2022, 7, 12, 10, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Key: "A", Time: at, Referrer: "https://example.com/", UserAgent: "curl/7.88.1", ClientIP: "203.0.113.0", RequestID: "host/1"},
+		{Key: "B", Time: at.Add(time.Minute)},
+	}
+	for _, e := range events {
+		rec.Record(e)
+	}
+	rec.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("expecting %d events, got: %q", len(events), buf.String())
+	}
+	for i, line := range lines {
+		var got Event
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != events[i] {
+			t.Fatalf("expecting %+v, got: %+v", events[i], got)
+		}
+	}
+	if strings.Contains(lines[1], "referrer") {
+		t.Fatalf("expecting empty fields to be omitted, got: %s", lines[1])
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "should mask the last octet of ipv4",
+			input:    "203.0.113.42",
+			expected: "203.0.113.0",
+		},
+		{
+			name:     "should keep the /48 of ipv6",
+			input:    "2001:db8:abcd:12:1:2:3:4",
+			expected: "2001:db8:abcd::",
+		},
+		{
+			name:     "should return empty string on invalid ip",
+			input:    "not-an-ip",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnonymizeIP(tt.input); got != tt.expected {
+				t.Fatalf("expecting %s, got: %s", tt.expected, got)
+			}
+		})
+	}
+}
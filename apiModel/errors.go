@@ -0,0 +1,35 @@
+package apiModel
+
+// Error codes returned in the error envelope of failed responses, they are stable and can be matched by clients
+const (
+	CodeInvalidMethod    = "invalid_method"
+	CodeInvalidBody      = "invalid_body"
+	CodeInvalidQuery     = "invalid_query"
+	CodeBatchTooLarge    = "batch_too_large"
+	CodeInvalidURL       = "invalid_url"
+	CodeDeniedDomain     = "denied_domain"
+	CodeUnsafeURL        = "unsafe_url"
+	CodeSelfLink         = "self_link"
+	CodeRedirectLoop     = "redirect_loop"
+	CodeUnreachableURL   = "unreachable_url"
+	CodePrivateAddress   = "private_address"
+	CodeInvalidAlias     = "invalid_alias"
+	CodeAliasTaken       = "alias_taken"
+	CodeInvalidExpiry    = "invalid_expiry"
+	CodeInvalidRedirect  = "invalid_redirect_code"
+	CodeNotFound         = "not_found"
+	CodeExpired          = "expired"
+	CodeUsedUp           = "used_up"
+	CodeBlocked          = "blocked"
+	CodeNotYetActive     = "not_yet_active"
+	CodeInvalidSchedule  = "invalid_schedule"
+	CodeInvalidMaxUses   = "invalid_max_uses"
+	CodePasswordRequired = "password_required"
+	CodeInvalidPassword  = "invalid_password"
+	CodeTooManyAttempts  = "too_many_attempts"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeSharedLink       = "shared_link"
+	CodeDisabled         = "disabled"
+	CodeInternal         = "internal_error"
+)
@@ -1,11 +1,144 @@
 package apiModel
 
+import (
+	"time"
+
+	"github.com/alexadhy/shortener/render"
+)
+
 // CreateShortLinkRequest is the request type to create new short link URL
 type CreateShortLinkRequest struct {
 	OriginalURL string `json:"url"`
+	// Alias is an optional custom short code, e.g. "q3-report"
+	Alias string `json:"alias,omitempty"`
+	// RedirectCode is one of 301, 302, 307 or 308, the server default is used if it is omitted
+	RedirectCode int `json:"redirect_code,omitempty"`
+
+	// at most one of TTL, ExpiresAt and NeverExpire can be set, the server default expiry is used otherwise
+	// TTL is the number of seconds the link is valid for
+	TTL         int64      `json:"ttl,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	NeverExpire bool       `json:"never_expire,omitempty"`
+
+	// Fallback is an optional URL the link redirects to once expired
+	Fallback string `json:"fallback_url,omitempty"`
+	// Password protects the link, it has to be given before being redirected
+	Password string `json:"password,omitempty"`
+	// MaxUses is how many times the link can be followed, e.g. 1 for a one-time link, 0 means unlimited
+	MaxUses int `json:"max_uses,omitempty"`
+
+	// NotBefore schedules the link, it doesn't redirect before then
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	// Prelaunch is an optional URL the link redirects to until NotBefore
+	Prelaunch string `json:"prelaunch_url,omitempty"`
 }
 
 // CreateShortLinkResponse is the response type to create new short link URL
 type CreateShortLinkResponse struct {
 	ShortLinkURL string `json:"url"`
+	// ManageToken is only returned to the creator of the link, it is required to update or delete it
+	ManageToken string `json:"manage_token,omitempty"`
+	// ExpiresAt is the effective expiry of the link, null if it never expires
+	ExpiresAt *time.Time `json:"expires_at"`
+	// NotBefore is when the link starts redirecting, omitted if it already does
+	NotBefore *time.Time `json:"not_before,omitempty"`
+}
+
+// BatchLinkResult is the outcome of one link of a batch creation, Link is set if it was created and Error otherwise
+// Status is the status code the link would have been answered with by itself
+type BatchLinkResult struct {
+	Status int                      `json:"status"`
+	Link   *CreateShortLinkResponse `json:"link,omitempty"`
+	Error  *render.Error            `json:"error,omitempty"`
+}
+
+// BatchCreateResponse is the response type to create a batch of short links
+// Results are in the order of the links of the request
+type BatchCreateResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchLinkResult `json:"results"`
+}
+
+// UpdateShortLinkRequest is the request type to change the destination and/or the expiry of a short link
+type UpdateShortLinkRequest struct {
+	OriginalURL *string    `json:"url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// NeverExpire removes the expiry of the link, it can't be combined with ExpiresAt
+	NeverExpire bool `json:"never_expire,omitempty"`
+	// Fallback replaces the URL the link redirects to once expired, an empty string removes it
+	Fallback *string `json:"fallback_url,omitempty"`
+	// Password replaces the password protecting the link, an empty string removes it
+	Password *string `json:"password,omitempty"`
+}
+
+// UpdateShortLinkResponse is the response type to change a short link
+type UpdateShortLinkResponse struct {
+	ShortLinkURL string     `json:"url"`
+	OriginalURL  string     `json:"original_url"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+// LinkSummary describes a stored short link, ExpiresAt is null if it never expires
+// NotBefore is only set for links which don't redirect yet, Blocked for the disabled ones with the reason why
+type LinkSummary struct {
+	Short        string     `json:"short"`
+	ShortLinkURL string     `json:"url"`
+	OriginalURL  string     `json:"original_url"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	NotBefore    *time.Time `json:"not_before,omitempty"`
+	PrelaunchURL string     `json:"prelaunch_url,omitempty"`
+	Custom       bool       `json:"custom"`
+	FallbackURL  string     `json:"fallback_url,omitempty"`
+	Protected    bool       `json:"protected,omitempty"`
+	MaxUses      int        `json:"max_uses,omitempty"`
+	Uses         int        `json:"uses,omitempty"`
+	Blocked      string     `json:"blocked,omitempty"`
+	Probe        *LinkProbe `json:"probe,omitempty"`
+}
+
+// LinkProbe is the outcome of the last reachability check of the destination of a link
+// StatusCode is the one answered at FinalURL after the redirects, Error is set if there was no answer
+type LinkProbe struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	FinalURL   string    `json:"final_url,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Broken     bool      `json:"broken"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// LinkInfoResponse describes where a short link goes without following it
+// OriginalURL is omitted for the links which are protected, disabled or don't redirect yet, Clicks if analytics are disabled
+type LinkInfoResponse struct {
+	Short        string     `json:"short"`
+	ShortLinkURL string     `json:"url"`
+	OriginalURL  string     `json:"original_url,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	NotBefore    *time.Time `json:"not_before,omitempty"`
+	Protected    bool       `json:"protected,omitempty"`
+	Blocked      bool       `json:"blocked,omitempty"`
+	MaxUses      int        `json:"max_uses,omitempty"`
+	Uses         int        `json:"uses,omitempty"`
+	Clicks       *int64     `json:"clicks,omitempty"`
+}
+
+// ListLinksResponse is the response type to list stored short links
+type ListLinksResponse struct {
+	Links      []LinkSummary `json:"links"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// StatsPoint is the number of clicks during the bucket starting at Start
+type StatsPoint struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// LinkStatsResponse is the response type of the click statistics of a short link
+type LinkStatsResponse struct {
+	Short  string       `json:"short"`
+	Total  int64        `json:"total"`
+	Hourly []StatsPoint `json:"hourly"`
+	Daily  []StatsPoint `json:"daily"`
 }
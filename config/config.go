@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -11,16 +15,54 @@ const (
 	defaultRedisAddr = "localhost:6379"
 	defaultPort      = "8388"
 	defaultHost      = "localhost"
+	defaultGenerator = "hash"
+	defaultBackend   = "badger"
+	defaultRedirect  = 301
+	defaultExpiry    = 30 * 24 * time.Hour
+	defaultMinExpiry = 5 * time.Minute
+	defaultBatchSize = 100
 )
 
 // Options is the option to run the application
 type Options struct {
-	Host   string        `json:"host" env:"APP_HOST"`
-	Domain string        `json:"domain" env:"APP_DOMAIN"`
-	Port   string        `json:"port" env:"APP_PORT"`
-	Expiry time.Duration `json:"duration" env:"APP_EXPIRY"`
-	Redis  RedisOption   `json:"redis,omitempty"`
-	Badger BadgerOption  `json:"badger,omitempty"`
+	Host   string         `json:"host" env:"APP_HOST"`
+	Domain string         `json:"domain" env:"APP_DOMAIN"`
+	Port   string         `json:"port" env:"APP_PORT"`
+	Expiry *time.Duration `json:"duration" env:"APP_EXPIRY"`
+	Redis  RedisOption    `json:"redis,omitempty"`
+	Badger BadgerOption   `json:"badger,omitempty"`
+
+	// Backend is the name of the persistence layer to use, e.g. badger, redis or memory
+	Backend   string          `json:"backend" env:"APP_BACKEND"`
+	Generator GeneratorOption `json:"generator,omitempty"`
+	// AliasDomains are the other domains serving the short links of Domain, e.g. sho.rt for https://www.sho.rt
+	AliasDomains []string          `json:"alias_domains" env:"APP_ALIAS_DOMAINS"`
+	Analytics    AnalyticsOption   `json:"analytics,omitempty"`
+	Redirect     RedirectOption    `json:"redirect,omitempty"`
+	URL          URLOption         `json:"url,omitempty"`
+	Domains      DomainOption      `json:"domains,omitempty"`
+	Threats      ThreatOption      `json:"threats,omitempty"`
+	Probe        ProbeOption       `json:"probe,omitempty"`
+	HealthCheck  HealthCheckOption `json:"health_check,omitempty"`
+	// AdminToken guards the /api endpoints, they are disabled if it is empty
+	AdminToken string `json:"admin_token" env:"APP_ADMIN_TOKEN"`
+	// TrustedProxies are the IP addresses or CIDR blocks of the reverse proxies whose X-Forwarded-For header is trusted
+	TrustedProxies []string `json:"trusted_proxies" env:"APP_TRUSTED_PROXIES"`
+
+	// MinExpiry and MaxExpiry bound the expiry clients can ask for a link
+	// links can only be created without expiry if MaxExpiry is 0
+	// Expiry and MinExpiry are pointers so an explicit 0, for links which never expire by default
+	// or for no lower bound, can be told apart from an unset value, which gets the default
+	MinExpiry *time.Duration `json:"min_expiry" env:"APP_MIN_EXPIRY"`
+	MaxExpiry time.Duration  `json:"max_expiry" env:"APP_MAX_EXPIRY"`
+
+	// ExpireInterval is how often the expired links are evicted from the storage layer
+	ExpireInterval time.Duration `json:"expire_interval" env:"APP_EXPIRE_INTERVAL"`
+	// MaxBatchSize is how many links can be created at once with POST /api/links/batch
+	MaxBatchSize int `json:"max_batch_size" env:"APP_MAX_BATCH_SIZE"`
+
+	// TemplatesDir holds HTML templates replacing the default pages served to browsers, e.g. expired.html
+	TemplatesDir string `json:"templates_dir" env:"APP_TEMPLATES_DIR"`
 }
 
 func New(getOptionFn func() Options) Options {
@@ -41,6 +83,30 @@ func New(getOptionFn func() Options) Options {
 		o.Domain = fmt.Sprintf("http://" + o.Host + ":" + o.Port)
 	}
 
+	if o.Backend == "" {
+		o.Backend = defaultBackend
+	}
+
+	if o.Generator.Type == "" {
+		o.Generator.Type = defaultGenerator
+	}
+
+	if o.Expiry == nil {
+		o.Expiry = durationPtr(defaultExpiry)
+	}
+
+	if o.MinExpiry == nil {
+		o.MinExpiry = durationPtr(defaultMinExpiry)
+	}
+
+	if o.MaxBatchSize == 0 {
+		o.MaxBatchSize = defaultBatchSize
+	}
+
+	if o.Redirect.Code == 0 {
+		o.Redirect.Code = defaultRedirect
+	}
+
 	if o.Badger.Path == "" {
 		o.Badger.Path = filepath.Join(os.TempDir(), "shortener-badger")
 	}
@@ -48,23 +114,308 @@ func New(getOptionFn func() Options) Options {
 	return o
 }
 
+// Validate checks every option used by the selected backend and reports all the invalid ones at once
+func (o Options) Validate() error {
+	validators := []namedValidator{
+		{"generator", o.Generator},
+		{"redirect", o.Redirect},
+		{"url", o.URL},
+		{"domains", o.Domains},
+		{"threats", o.Threats},
+		{"trusted_proxies", trustedProxies(o.TrustedProxies)},
+		{"expiry", expiryBounds{durationOf(o.Expiry), durationOf(o.MinExpiry), o.MaxExpiry}},
+	}
+	switch o.Backend {
+	case "redis":
+		validators = append(validators, namedValidator{"redis", o.Redis})
+	case "badger":
+		validators = append(validators, namedValidator{"badger", o.Badger})
+	}
+
+	var errs ValidationError
+	for _, v := range validators {
+		if err := v.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+// durationOf returns the duration p points to, 0 if it is nil
+func durationOf(p *time.Duration) time.Duration {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+type validator interface {
+	Validate() error
+}
+
+type namedValidator struct {
+	name string
+	validator
+}
+
+// ValidationError aggregates the errors of every invalid option
+type ValidationError []error
+
+func (v ValidationError) Error() string {
+	msgs := make([]string, len(v))
+	for i, err := range v {
+		msgs[i] = err.Error()
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
 // RedisOption contains addresses to be used for redis
 type RedisOption struct {
-	Addresses []string `json:"addresses"`
+	Addresses []string `json:"addresses" env:"APP_REDIS_ADDRESSES"`
 }
 
 func (r RedisOption) Validate() error {
+	if len(r.Addresses) == 0 {
+		return errors.New("at least one address is required")
+	}
+	for _, addr := range r.Addresses {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+	}
 	return nil
 }
 
 // BadgerOption is the option for badger
 type BadgerOption struct {
-	Path string `json:"path"`
+	Path string `json:"path" env:"APP_BADGER_PATH"`
 }
 
+// Validate checks that Path is a directory, or that it can be created in an existing directory
 func (b BadgerOption) Validate() error {
-	if _, err := os.Stat(b.Path); err != nil {
+	fi, err := os.Stat(b.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		fi, err = os.Stat(filepath.Dir(b.Path))
+	}
+	if err != nil {
 		return err
 	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", b.Path)
+	}
+	return nil
+}
+
+// GeneratorOption selects how short codes are generated
+// Type is one of hash, random or counter
+type GeneratorOption struct {
+	Type   string `json:"type" env:"APP_GENERATOR"`
+	Length int    `json:"length" env:"APP_GENERATOR_LENGTH"`
+	Salt   string `json:"salt" env:"APP_GENERATOR_SALT"`
+}
+
+func (g GeneratorOption) Validate() error {
+	switch g.Type {
+	case "hash", "random", "counter":
+		return nil
+	default:
+		return fmt.Errorf("unknown generator type %q", g.Type)
+	}
+}
+
+// AnalyticsOption configures the click analytics pipeline
+// EventsFile is where every redirect is appended as a JSON line, events are only counted if empty
+type AnalyticsOption struct {
+	Disabled      bool          `json:"disabled" env:"APP_ANALYTICS_DISABLED"`
+	BufferSize    int           `json:"buffer_size" env:"APP_ANALYTICS_BUFFER_SIZE"`
+	FlushInterval time.Duration `json:"flush_interval" env:"APP_ANALYTICS_FLUSH_INTERVAL"`
+	EventsFile    string        `json:"events_file" env:"APP_ANALYTICS_EVENTS_FILE"`
+}
+
+// RedirectOption configures the redirects of links which don't set their own status code
+// PrelaunchURL is where scheduled links without their own pre-launch URL redirect to before they start
+type RedirectOption struct {
+	Code         int    `json:"code" env:"APP_REDIRECT_CODE"`
+	PrelaunchURL string `json:"prelaunch_url" env:"APP_PRELAUNCH_URL"`
+}
+
+func (r RedirectOption) Validate() error {
+	switch r.Code {
+	case 301, 302, 307, 308:
+	default:
+		return fmt.Errorf("unsupported redirect code %d, has to be one of 301, 302, 307 or 308", r.Code)
+	}
+	if r.PrelaunchURL != "" {
+		u, err := url.Parse(r.PrelaunchURL)
+		if err != nil {
+			return fmt.Errorf("invalid prelaunch_url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("prelaunch_url %q has to be an absolute http(s) URL", r.PrelaunchURL)
+		}
+	}
+	return nil
+}
+
+// URLOption configures how the submitted URLs are validated and canonicalized, see urlnorm.Options
+// Schemes defaults to http and https
+type URLOption struct {
+	Schemes       []string `json:"schemes" env:"APP_URL_SCHEMES"`
+	StripFragment bool     `json:"strip_fragment" env:"APP_URL_STRIP_FRAGMENT"`
+	SortQuery     bool     `json:"sort_query" env:"APP_URL_SORT_QUERY"`
+}
+
+func (u URLOption) Validate() error {
+	for _, s := range u.Schemes {
+		if !validScheme(s) {
+			return fmt.Errorf("invalid scheme %q", s)
+		}
+	}
+	return nil
+}
+
+// validScheme reports whether s is a scheme as defined by RFC 3986
+func validScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case (c >= '0' && c <= '9') || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// DomainOption restricts the destination hosts which can be shortened, see domainpolicy.Options
+// everything which isn't denied is allowed if there is no allow list
+type DomainOption struct {
+	Allow          []string      `json:"allow" env:"APP_DOMAINS_ALLOW"`
+	Deny           []string      `json:"deny" env:"APP_DOMAINS_DENY"`
+	AllowFiles     []string      `json:"allow_files" env:"APP_DOMAINS_ALLOW_FILES"`
+	DenyFiles      []string      `json:"deny_files" env:"APP_DOMAINS_DENY_FILES"`
+	ReloadInterval time.Duration `json:"reload_interval" env:"APP_DOMAINS_RELOAD_INTERVAL"`
+}
+
+// Validate checks that the list files exist, their entries are only checked once loaded
+func (d DomainOption) Validate() error {
+	return checkFiles(d.AllowFiles, d.DenyFiles)
+}
+
+// ThreatOption configures the threat lists the destinations are screened against, see threat.Options
+// screening is disabled if there are no files
+type ThreatOption struct {
+	HostFiles       []string      `json:"host_files" env:"APP_THREATS_HOST_FILES"`
+	URLPrefixFiles  []string      `json:"url_prefix_files" env:"APP_THREATS_URL_PREFIX_FILES"`
+	HashPrefixFiles []string      `json:"hash_prefix_files" env:"APP_THREATS_HASH_PREFIX_FILES"`
+	ReloadInterval  time.Duration `json:"reload_interval" env:"APP_THREATS_RELOAD_INTERVAL"`
+	// CheckRedirects screens the destination of a link again whenever it is followed
+	CheckRedirects bool `json:"check_redirects" env:"APP_THREATS_CHECK_REDIRECTS"`
+}
+
+// Enabled reports whether any list file is configured
+func (t ThreatOption) Enabled() bool {
+	return len(t.HostFiles)+len(t.URLPrefixFiles)+len(t.HashPrefixFiles) > 0
+}
+
+// Validate checks that the list files exist, their entries are only checked once loaded
+func (t ThreatOption) Validate() error {
+	return checkFiles(t.HostFiles, t.URLPrefixFiles, t.HashPrefixFiles)
+}
+
+// ProbeOption configures the reachability check of the destinations on creation, see probe.Options
+type ProbeOption struct {
+	Enabled      bool          `json:"enabled" env:"APP_PROBE_ENABLED"`
+	Timeout      time.Duration `json:"timeout" env:"APP_PROBE_TIMEOUT"`
+	MaxRedirects int           `json:"max_redirects" env:"APP_PROBE_MAX_REDIRECTS"`
+}
+
+// HealthCheckOption configures the periodic check of the destinations of the stored links, see healthcheck.Options
+// the destinations are probed with the timeout and redirect limit of ProbeOption
+type HealthCheckOption struct {
+	Enabled     bool          `json:"enabled" env:"APP_HEALTH_CHECK_ENABLED"`
+	Interval    time.Duration `json:"interval" env:"APP_HEALTH_CHECK_INTERVAL"`
+	Concurrency int           `json:"concurrency" env:"APP_HEALTH_CHECK_CONCURRENCY"`
+	HostDelay   time.Duration `json:"host_delay" env:"APP_HEALTH_CHECK_HOST_DELAY"`
+}
+
+// checkFiles checks that every file of lists exists and isn't a directory
+func checkFiles(lists ...[]string) error {
+	for _, names := range lists {
+		for _, name := range names {
+			fi, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				return fmt.Errorf("%s is a directory", name)
+			}
+		}
+	}
+	return nil
+}
+
+// trustedProxies checks that every entry is an IP address or a CIDR block
+type trustedProxies []string
+
+func (t trustedProxies) Validate() error {
+	_, err := ParseNets(t)
+	return err
+}
+
+// ParseNets parses IP addresses and CIDR blocks, an IP address is returned as the block of that single address
+func ParseNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, e := range entries {
+		if ip := net.ParseIP(e); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP address nor a CIDR block", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// expiryBounds checks that the default expiry is within the bounds, a default of 0 never expires
+// and is only within them without max
+type expiryBounds struct {
+	def, min, max time.Duration
+}
+
+func (e expiryBounds) Validate() error {
+	switch {
+	case e.def < 0:
+		return errors.New("default expiry can't be negative")
+	case e.min < 0 || e.max < 0:
+		return errors.New("bounds can't be negative")
+	case e.max > 0 && e.min > e.max:
+		return fmt.Errorf("min_expiry %s is greater than max_expiry %s", e.min, e.max)
+	case e.def == 0 && e.max > 0:
+		return fmt.Errorf("default expiry can't be never with max_expiry %s", e.max)
+	case e.def > 0 && (e.def < e.min || (e.max > 0 && e.def > e.max)):
+		return fmt.Errorf("default expiry %s is out of bounds", e.def)
+	}
 	return nil
 }
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the options from the config file at path, if any, then overrides them from
+// the environment variables named by the env tags, and finally applies the defaults of New
+// the format of the file is picked from its extension: .json, .yaml, .yml or .toml
+// keys of the file are the json tags of Options, durations are either strings like "72h" or a number of seconds
+func Load(path string) (Options, error) {
+	var o Options
+	if path != "" {
+		raw, err := readFile(path)
+		if err != nil {
+			return o, err
+		}
+		if err = assign(reflect.ValueOf(&o).Elem(), raw, ""); err != nil {
+			return o, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&o).Elem()); err != nil {
+		return o, err
+	}
+
+	return New(func() Options { return o }), nil
+}
+
+func readFile(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(b, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return raw, nil
+}
+
+// assign sets the fields of the struct v from raw, matching the keys against the json tags
+func assign(v reflect.Value, raw map[string]any, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		val, ok := raw[name]
+		if !ok || val == nil {
+			continue
+		}
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			m, ok := val.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s%s: expecting an object", prefix, name)
+			}
+			if err := assign(field, m, prefix+name+"."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := setValue(field, val); err != nil {
+			return fmt.Errorf("%s%s: %w", prefix, name, err)
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides the fields of the struct v from the environment variables named by their env tag
+func applyEnv(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := t.Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(field, val); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setValue sets field from a value decoded from a config file or from an environment variable
+// a nil pointer field is allocated, so a zero value can be told apart from an unset field
+func setValue(field reflect.Value, val any) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), val); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.Type() == durationType {
+		d, err := parseDuration(val)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(fmt.Sprint(val))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(fmt.Sprint(val))
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(fmt.Sprint(val), 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(fmt.Sprint(val), 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", field.Type())
+		}
+		field.Set(reflect.ValueOf(parseStrings(val)))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+func parseDuration(val any) (time.Duration, error) {
+	switch v := val.(type) {
+	case string:
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(secs * float64(time.Second)), nil
+		}
+		return time.ParseDuration(v)
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("invalid duration %v", val)
+	}
+}
+
+// parseStrings accepts either a list or a comma separated string
+func parseStrings(val any) []string {
+	var res []string
+	switch v := val.(type) {
+	case []any:
+		for _, s := range v {
+			res = append(res, strings.TrimSpace(fmt.Sprint(s)))
+		}
+	default:
+		for _, s := range strings.Split(fmt.Sprint(v), ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,236 @@
+package config_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/config"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		env      map[string]string
+		expected func(o config.Options)
+		hasError bool
+	}{
+		{
+			name:    "should load a json file",
+			file:    "config.json",
+			content: `{"host": "0.0.0.0", "duration": "72h", "redis": {"addresses": ["redis-1:6379", "redis-2:6379"]}}`,
+			expected: func(o config.Options) {
+				assert.Equal(t, "0.0.0.0", o.Host)
+				assert.Equal(t, 72*time.Hour, *o.Expiry)
+				assert.Equal(t, []string{"redis-1:6379", "redis-2:6379"}, o.Redis.Addresses)
+			},
+		},
+		{
+			name:    "should load a yaml file",
+			file:    "config.yaml",
+			content: "port: \"9000\"\nduration: 3600\nbadger:\n  path: /tmp/badger\ngenerator:\n  type: random\n  length: 9\n",
+			expected: func(o config.Options) {
+				assert.Equal(t, "9000", o.Port)
+				assert.Equal(t, time.Hour, *o.Expiry)
+				assert.Equal(t, "/tmp/badger", o.Badger.Path)
+				assert.Equal(t, "random", o.Generator.Type)
+				assert.Equal(t, 9, o.Generator.Length)
+			},
+		},
+		{
+			name:    "should load a toml file",
+			file:    "config.toml",
+			content: "domain = \"https://sho.rt\"\n[redis]\naddresses = \"redis-1:6379, redis-2:6379\"\n",
+			expected: func(o config.Options) {
+				assert.Equal(t, "https://sho.rt", o.Domain)
+				assert.Equal(t, []string{"redis-1:6379", "redis-2:6379"}, o.Redis.Addresses)
+			},
+		},
+		{
+			name:    "environment variables override the file",
+			file:    "config.json",
+			content: `{"port": "9000", "duration": "1h"}`,
+			env: map[string]string{
+				"APP_PORT":                    "8080",
+				"APP_EXPIRY":                  "90m",
+				"APP_REDIS_ADDRESSES":         "a:1,b:2",
+				"APP_ANALYTICS_DISABLED":      "true",
+				"APP_REDIRECT_CODE":           "302",
+				"APP_PRELAUNCH_URL":           "https://example.com/soon",
+				"APP_MAX_BATCH_SIZE":          "500",
+				"APP_URL_SCHEMES":             "https,ftp",
+				"APP_URL_SORT_QUERY":          "true",
+				"APP_DOMAINS_DENY":            "*.tk,10.0.0.0/8",
+				"APP_THREATS_CHECK_REDIRECTS": "true",
+				"APP_ALIAS_DOMAINS":           "sho.rt,https://www.sho.rt",
+				"APP_PROBE_ENABLED":           "true",
+				"APP_PROBE_TIMEOUT":           "3s",
+				"APP_HEALTH_CHECK_ENABLED":    "true",
+				"APP_HEALTH_CHECK_INTERVAL":   "12h",
+				"APP_TRUSTED_PROXIES":         "10.0.0.1,fd00::/8",
+				"APP_THREATS_RELOAD_INTERVAL": "60",
+				"APP_ANALYTICS_EVENTS_FILE":   "/var/log/shortener/events.jsonl",
+			},
+			expected: func(o config.Options) {
+				assert.Equal(t, "8080", o.Port)
+				assert.Equal(t, 90*time.Minute, *o.Expiry)
+				assert.Equal(t, []string{"a:1", "b:2"}, o.Redis.Addresses)
+				assert.True(t, o.Analytics.Disabled)
+				assert.Equal(t, "/var/log/shortener/events.jsonl", o.Analytics.EventsFile)
+				assert.Equal(t, 302, o.Redirect.Code)
+				assert.Equal(t, "https://example.com/soon", o.Redirect.PrelaunchURL)
+				assert.Equal(t, 500, o.MaxBatchSize)
+				assert.Equal(t, []string{"https", "ftp"}, o.URL.Schemes)
+				assert.True(t, o.URL.SortQuery)
+				assert.False(t, o.URL.StripFragment)
+				assert.Equal(t, []string{"*.tk", "10.0.0.0/8"}, o.Domains.Deny)
+				assert.True(t, o.Threats.CheckRedirects)
+				assert.Equal(t, []string{"sho.rt", "https://www.sho.rt"}, o.AliasDomains)
+				assert.True(t, o.Probe.Enabled)
+				assert.Equal(t, 3*time.Second, o.Probe.Timeout)
+				assert.True(t, o.HealthCheck.Enabled)
+				assert.Equal(t, 12*time.Hour, o.HealthCheck.Interval)
+				assert.Equal(t, []string{"10.0.0.1", "fd00::/8"}, o.TrustedProxies)
+				nets, err := config.ParseNets(o.TrustedProxies)
+				assert.Nil(t, err)
+				if assert.Len(t, nets, 2) {
+					assert.True(t, nets[0].Contains(net.ParseIP("10.0.0.1")))
+					assert.False(t, nets[0].Contains(net.ParseIP("10.0.0.2")))
+					assert.True(t, nets[1].Contains(net.ParseIP("fd12::1")))
+				}
+				assert.Equal(t, time.Minute, o.Threats.ReloadInterval)
+				assert.False(t, o.Threats.Enabled())
+				assert.Equal(t, "http://localhost:8080", o.Domain)
+			},
+		},
+		{
+			name:    "should keep an explicit 0 expiry",
+			file:    "config.yaml",
+			content: "duration: 0\nmin_expiry: 0s\n",
+			expected: func(o config.Options) {
+				assert.Equal(t, time.Duration(0), *o.Expiry)
+				assert.Equal(t, time.Duration(0), *o.MinExpiry)
+				assert.Nil(t, o.Validate())
+			},
+		},
+		{
+			name: "should keep an explicit 0 expiry from the environment",
+			env:  map[string]string{"APP_EXPIRY": "0", "APP_MIN_EXPIRY": "0"},
+			expected: func(o config.Options) {
+				assert.Equal(t, time.Duration(0), *o.Expiry)
+				assert.Equal(t, time.Duration(0), *o.MinExpiry)
+			},
+		},
+		{
+			name: "should refuse a default expiry of 0 with a max_expiry",
+			env:  map[string]string{"APP_EXPIRY": "0", "APP_MAX_EXPIRY": "24h"},
+			expected: func(o config.Options) {
+				err := o.Validate()
+				assert.NotNil(t, err)
+				assert.Contains(t, err.Error(), "expiry:")
+			},
+		},
+		{
+			name: "should default an unset expiry",
+			expected: func(o config.Options) {
+				assert.Equal(t, 30*24*time.Hour, *o.Expiry)
+				assert.Equal(t, 5*time.Minute, *o.MinExpiry)
+			},
+		},
+		{
+			name:     "should fail on an invalid duration",
+			file:     "config.json",
+			content:  `{"duration": "forever"}`,
+			hasError: true,
+		},
+		{
+			name:     "should fail on an invalid environment variable",
+			env:      map[string]string{"APP_GENERATOR_LENGTH": "seven"},
+			hasError: true,
+		},
+		{
+			name:     "should fail on an unsupported format",
+			file:     "config.ini",
+			content:  "host=localhost",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeConfig(t, tt.file, tt.content)
+			}
+
+			o, err := config.Load(path)
+			if tt.hasError {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			tt.expected(o)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	o, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, o.Validate())
+
+	o.Redis.Addresses = []string{"no-port"}
+	o.Badger.Path = filepath.Join(t.TempDir(), "missing", "badger")
+	o.Generator.Type = "uuid"
+	o.Redirect.Code = 303
+	o.MaxExpiry = time.Hour
+	o.URL.Schemes = []string{"https", "1http"}
+	o.Domains.DenyFiles = []string{filepath.Join(t.TempDir(), "missing.txt")}
+	o.Threats.HashPrefixFiles = []string{t.TempDir()}
+	o.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"}
+
+	tests := []struct {
+		backend  string
+		reported []string
+		ignored  []string
+	}{
+		{backend: "badger", reported: []string{"badger", "generator", "redirect", "url", "domains", "threats", "trusted_proxies", "expiry"}, ignored: []string{"redis"}},
+		{backend: "redis", reported: []string{"redis", "generator", "redirect", "url", "domains", "threats", "trusted_proxies", "expiry"}, ignored: []string{"badger"}},
+		{backend: "memory", reported: []string{"generator", "redirect", "url", "domains", "threats", "trusted_proxies", "expiry"}, ignored: []string{"redis", "badger"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			o.Backend = tt.backend
+			err := o.Validate()
+			assert.NotNil(t, err)
+			for _, name := range tt.reported {
+				assert.True(t, strings.Contains(err.Error(), name+":"), "%s should be reported in %q", name, err)
+			}
+			for _, name := range tt.ignored {
+				assert.False(t, strings.Contains(err.Error(), name+":"), "%s should not be reported in %q", name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package domainpolicy_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/domainpolicy"
+)
+
+func TestRules(t *testing.T) {
+	rules, err := domainpolicy.NewRules(
+		"example.com",
+		"*.corp.example",
+		"Bücher.example",
+		"10.0.0.0/8",
+		"192.168.1.1",
+		"2001:db8::/32",
+		"127.0.0.0/8",
+		"0xac.1",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "example.com", want: true},
+		{host: "EXAMPLE.com.", want: true},
+		{host: "www.example.com", want: false},
+		{host: "wiki.corp.example", want: true},
+		{host: "a.b.corp.example", want: true},
+		{host: "corp.example", want: false},
+		{host: "evilcorp.example", want: false},
+		{host: "xn--bcher-kva.example", want: true},
+		{host: "10.1.2.3", want: true},
+		{host: "11.1.2.3", want: false},
+		{host: "192.168.1.1", want: true},
+		{host: "192.168.1.2", want: false},
+		{host: "[2001:db8::1]", want: true},
+		{host: "2001:db9::1", want: false},
+		{host: "167772161", want: true},
+		{host: "0xa000001", want: true},
+		{host: "127.1", want: true},
+		{host: "0x7f.1", want: true},
+		{host: "0177.0.0.1", want: true},
+		{host: "0300.0250.1.1", want: true},
+		{host: "3232235777", want: true},
+		{host: "172.0.0.1", want: true},
+		{host: "185273099", want: false},
+		{host: "1.2.3.256", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.want, rules.Match(tt.host))
+		})
+	}
+
+	for _, entry := range []string{"", "10.0.0.0/33", "exa mple.com", "*.", "a..b", "1.2.3.256"} {
+		t.Run("should refuse "+entry, func(t *testing.T) {
+			_, err := domainpolicy.NewRules(entry)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    domainpolicy.Options
+		allowed []string
+		denied  []string
+	}{
+		{
+			name:    "should allow everything without lists",
+			allowed: []string{"example.com", "10.0.0.1"},
+		},
+		{
+			name:    "should only allow the allow list",
+			opts:    domainpolicy.Options{Allow: []string{"*.example.com", "example.com"}},
+			allowed: []string{"example.com", "docs.example.com"},
+			denied:  []string{"example.org", "10.0.0.1"},
+		},
+		{
+			name:    "should give precedence to the deny list",
+			opts:    domainpolicy.Options{Allow: []string{"*.example.com"}, Deny: []string{"evil.example.com", "10.0.0.0/8"}},
+			allowed: []string{"docs.example.com"},
+			denied:  []string{"evil.example.com", "10.0.0.1"},
+		},
+		{
+			name:    "should deny the deny list only",
+			opts:    domainpolicy.Options{Deny: []string{"*.tk", "127.0.0.0/8", "::1"}},
+			allowed: []string{"example.com"},
+			denied:  []string{"free.tk", "127.0.0.1", "[::1]"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := domainpolicy.New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			for _, host := range tt.allowed {
+				assert.True(t, p.Allowed(host), "%s should be allowed", host)
+			}
+			for _, host := range tt.denied {
+				assert.False(t, p.Allowed(host), "%s should be denied", host)
+			}
+		})
+	}
+}
+
+func TestPolicyReload(t *testing.T) {
+	denyFile := filepath.Join(t.TempDir(), "deny.txt")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(denyFile, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(denyFile, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("# phishing\nbad.example\n\n*.spam.example # whole zone\n", start)
+
+	_, err := domainpolicy.New(domainpolicy.Options{DenyFiles: []string{filepath.Join(t.TempDir(), "missing.txt")}})
+	assert.NotNil(t, err)
+
+	p, err := domainpolicy.New(domainpolicy.Options{DenyFiles: []string{denyFile}, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	assert.False(t, p.Allowed("bad.example"))
+	assert.False(t, p.Allowed("www.spam.example"))
+	assert.True(t, p.Allowed("worse.example"))
+
+	write("worse.example\n", start.Add(time.Minute))
+	assert.Eventually(t, func() bool {
+		return !p.Allowed("worse.example")
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, p.Allowed("bad.example"))
+
+	// an invalid file is reported and the current lists are kept
+	write("not a host\n", start.Add(2*time.Minute))
+	assert.NotNil(t, p.Reload())
+	assert.False(t, p.Allowed("worse.example"))
+}
+
+func BenchmarkAllowed(b *testing.B) {
+	deny := make([]string, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		deny = append(deny, "host"+strconv.Itoa(i)+".example", "*.zone"+strconv.Itoa(i)+".example")
+	}
+	p, err := domainpolicy.New(domainpolicy.Options{Deny: deny})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Allowed("a.b.c.zone9999.example")
+	}
+}
@@ -0,0 +1,121 @@
+// Package domainpolicy decides which destination hosts can be shortened, from allow and deny lists
+// given inline or in files which are reloaded when they change
+package domainpolicy
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexadhy/shortener/internal/filewatch"
+	"github.com/alexadhy/shortener/internal/log"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Options configures a Policy, see Rules for the format of the entries
+// the files hold one entry per line, blank lines and comments starting with # are skipped
+type Options struct {
+	Allow      []string
+	Deny       []string
+	AllowFiles []string
+	DenyFiles  []string
+	// ReloadInterval is how often the files are checked for changes, defaulted if not positive
+	ReloadInterval time.Duration
+}
+
+// Policy allows a host unless it matches the deny list, and if the allow list isn't empty, only when it matches it
+type Policy struct {
+	opts    Options
+	watcher *filewatch.Watcher
+
+	mu    sync.RWMutex
+	allow *Rules
+	deny  *Rules
+}
+
+// New loads the lists of opts and starts watching their files if there are any, Close has to be called to stop it
+func New(opts Options) (*Policy, error) {
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = defaultReloadInterval
+	}
+	p := &Policy{opts: opts}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	if files := append(append([]string{}, opts.AllowFiles...), opts.DenyFiles...); len(files) > 0 {
+		p.watcher = filewatch.New(files, opts.ReloadInterval, func() error {
+			if err := p.Reload(); err != nil {
+				return fmt.Errorf("domain policy: %w", err)
+			}
+			log.Infof("domain policy reloaded")
+			return nil
+		})
+	}
+	return p, nil
+}
+
+// Allowed reports whether host can be shortened, it is meant to be passed as the domain filter of handlers.New
+func (p *Policy) Allowed(host string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.deny.Match(host) {
+		return false
+	}
+	return p.allow.Len() == 0 || p.allow.Match(host)
+}
+
+// Reload reads the lists again, the current ones are kept if one of them is invalid
+func (p *Policy) Reload() error {
+	allow, err := LoadRules(p.opts.Allow, p.opts.AllowFiles...)
+	if err != nil {
+		return fmt.Errorf("allow list: %w", err)
+	}
+	deny, err := LoadRules(p.opts.Deny, p.opts.DenyFiles...)
+	if err != nil {
+		return fmt.Errorf("deny list: %w", err)
+	}
+
+	p.mu.Lock()
+	p.allow, p.deny = allow, deny
+	p.mu.Unlock()
+	return nil
+}
+
+// Close stops watching the files
+func (p *Policy) Close() {
+	if p.watcher != nil {
+		p.watcher.Close()
+	}
+}
+
+// LoadRules returns the rules made of entries and of the entries of the files
+// the files hold one entry per line, blank lines and comments starting with # are skipped
+func LoadRules(entries []string, files ...string) (*Rules, error) {
+	r, err := NewRules(entries...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range files {
+		if err = loadFile(r, name); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func loadFile(r *Rules, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = r.addFrom(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package domainpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+
+	"github.com/alexadhy/shortener/internal/ipv4"
+)
+
+// Rules matches hosts against a list of entries, each one being either
+//   - an exact host, e.g. example.com
+//   - a wildcard suffix, e.g. *.example.com, matching the subdomains of example.com but not example.com itself
+//   - an IP address or a CIDR block, e.g. 10.0.0.0/8, matching IP literal hosts
+//
+// IPv4 hosts are matched in every form browsers accept, e.g. 167772161, 10.1 or 0xa.0.0.1 are 10.0.0.1
+//
+// a host is looked up with one map access per label, so matching doesn't slow down with the number of entries
+type Rules struct {
+	hosts    map[string]struct{}
+	suffixes map[string]struct{}
+	nets     []*net.IPNet
+}
+
+// NewRules returns the rules of entries, or an error for the first invalid one
+func NewRules(entries ...string) (*Rules, error) {
+	r := &Rules{hosts: map[string]struct{}{}, suffixes: map[string]struct{}{}}
+	for _, e := range entries {
+		if err := r.Add(e); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add adds entry to the rules, see Rules for the supported entries
+// internationalized domain names are converted to punycode, as the hosts are matched once canonicalized by urlnorm
+func (r *Rules) Add(entry string) error {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if entry == "" {
+		return fmt.Errorf("empty entry")
+	}
+
+	if strings.Contains(entry, "/") {
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		r.nets = append(r.nets, n)
+		return nil
+	}
+	ip := net.ParseIP(strings.Trim(entry, "[]"))
+	if ip == nil {
+		v4, ok, err := ipv4.Parse(entry)
+		if err != nil {
+			return fmt.Errorf("invalid IP %q: %w", entry, err)
+		}
+		if ok {
+			ip = v4
+		}
+	}
+	if ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		r.nets = append(r.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		return nil
+	}
+
+	set := r.hosts
+	host := entry
+	if strings.HasPrefix(host, "*.") {
+		set, host = r.suffixes, host[2:]
+	}
+	host = strings.TrimSuffix(host, ".")
+	if !isASCII(host) {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return fmt.Errorf("invalid host %q: %w", entry, err)
+		}
+		host = ascii
+	}
+	if !validHost(host) {
+		return fmt.Errorf("invalid host %q", entry)
+	}
+	set[host] = struct{}{}
+	return nil
+}
+
+// Len returns the number of entries
+func (r *Rules) Len() int {
+	return len(r.hosts) + len(r.suffixes) + len(r.nets)
+}
+
+// Match reports whether host is matched by one of the entries, host is expected without port
+// IP literal hosts are only matched by the IP and CIDR entries, a host ending in a number which isn't a valid
+// IPv4 address is matched by none
+func (r *Rules) Match(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		v4, ok, err := ipv4.Parse(host)
+		if err != nil {
+			return false
+		}
+		if ok {
+			ip = v4
+		}
+	}
+	if ip != nil {
+		for _, n := range r.nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if _, ok := r.hosts[host]; ok {
+		return true
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if _, ok := r.suffixes[host]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addFrom adds the entries read from rd, one per line, blank lines and comments starting with # are skipped
+func (r *Rules) addFrom(rd io.Reader) error {
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		entry := sc.Text()
+		if i := strings.IndexByte(entry, '#'); i >= 0 {
+			entry = entry[:i]
+		}
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		if err := r.Add(entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// validHost reports whether host looks like a domain name, its labels being made of letters, digits, - and _
+func validHost(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/render"
+)
+
+const (
+	defaultMaxBatchSize = 100
+	// maxLinkRequestSize bounds the body of a batch along with its number of links
+	maxLinkRequestSize = 16 << 10
+	// maxBatchProbes is how many destinations of a batch are probed at once
+	maxBatchProbes = 8
+)
+
+// WithMaxBatchSize sets how many links can be created at once by CreateShortLinks, defaults to 100
+func WithMaxBatchSize(n int) Option {
+	return func(a *API) {
+		if n > 0 {
+			a.maxBatchSize = n
+		}
+	}
+}
+
+// CreateShortLinks creates the links of a JSON array of CreateShortLinkRequest at once, it requires the admin token
+// every link is validated and saved on its own, so an invalid one doesn't fail the others
+func (a *API) CreateShortLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	if err := a.authorizeAdmin(r); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(w, r.Body, int64(a.maxBatchSize)*maxLinkRequestSize)
+
+	var bodies []apiModel.CreateShortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&bodies); err != nil {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidBody, err)
+		return
+	}
+	if len(bodies) == 0 {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidBody, errors.New("at least one link is required"))
+		return
+	}
+	if len(bodies) > a.maxBatchSize {
+		handleErr(w, r, http.StatusRequestEntityTooLarge, apiModel.CodeBatchTooLarge,
+			fmt.Errorf("at most %d links can be created at once", a.maxBatchSize))
+		return
+	}
+
+	results := make([]apiModel.BatchLinkResult, len(bodies))
+	var links []*model.ShortenedData
+	var tokens []string
+	var indexes []int
+	for i, body := range bodies {
+		sd, token, status, rerr := a.newLink(r.Context(), body)
+		if rerr != nil {
+			results[i] = apiModel.BatchLinkResult{Status: status, Error: rerr}
+			continue
+		}
+		links = append(links, sd)
+		tokens = append(tokens, token)
+		indexes = append(indexes, i)
+	}
+
+	if a.prober != nil && len(links) > 0 {
+		failures := a.probeAll(r.Context(), links)
+		probed, probedTokens, probedIndexes := links[:0], tokens[:0], indexes[:0]
+		for j, failure := range failures {
+			if failure.Error != nil {
+				results[indexes[j]] = failure
+				continue
+			}
+			probed = append(probed, links[j])
+			probedTokens = append(probedTokens, tokens[j])
+			probedIndexes = append(probedIndexes, indexes[j])
+		}
+		links, tokens, indexes = probed, probedTokens, probedIndexes
+	}
+
+	if len(links) > 0 {
+		errs, err := persist.SaveMany(r.Context(), a.p, links, a.generator)
+		if err != nil {
+			log.Errorf("CreateShortLinks() SaveMany: %v", err)
+			handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+			return
+		}
+		for j, i := range indexes {
+			results[i] = a.savedLink(r, links[j], tokens[j], errs[j])
+		}
+	}
+
+	resp := apiModel.BatchCreateResponse{Results: results}
+	for _, res := range results {
+		if res.Error != nil {
+			resp.Failed++
+		} else {
+			resp.Created++
+		}
+	}
+	_, _ = render.Render(render.Response[any]{StatusCode: http.StatusOK, Data: resp}, w)
+}
+
+// probeAll probes the destinations of links concurrently, the result of a link which can't be created is at its index
+func (a *API) probeAll(ctx context.Context, links []*model.ShortenedData) []apiModel.BatchLinkResult {
+	failures := make([]apiModel.BatchLinkResult, len(links))
+	sem := make(chan struct{}, maxBatchProbes)
+	var wg sync.WaitGroup
+	for i, sd := range links {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, sd *model.ShortenedData) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if status, rerr := a.probe(ctx, sd); rerr != nil {
+				failures[i] = apiModel.BatchLinkResult{Status: status, Error: rerr}
+			}
+		}(i, sd)
+	}
+	wg.Wait()
+	return failures
+}
+
+// savedLink returns the result of saving sd, err is the error it was saved with
+func (a *API) savedLink(r *http.Request, sd *model.ShortenedData, token string, err error) apiModel.BatchLinkResult {
+	switch {
+	case err == nil:
+	case errors.Is(err, persist.ErrAliasTaken):
+		return apiModel.BatchLinkResult{Status: http.StatusConflict, Error: render.NewError(apiModel.CodeAliasTaken, err)}
+	default:
+		log.Errorf("CreateShortLinks() Set %s: %v", sd.Key, err)
+		return apiModel.BatchLinkResult{Status: http.StatusInternalServerError, Error: internalError()}
+	}
+
+	stored, err := a.p.Get(r.Context(), sd.Short)
+	if err != nil {
+		log.Errorf("CreateShortLinks() Get %s: %v", sd.Short, err)
+		return apiModel.BatchLinkResult{Status: http.StatusInternalServerError, Error: internalError()}
+	}
+	if err = a.share(r.Context(), stored, token); err != nil {
+		log.Errorf("CreateShortLinks() share %s: %v", sd.Short, err)
+		return apiModel.BatchLinkResult{Status: http.StatusInternalServerError, Error: internalError()}
+	}
+	link := a.createdLink(stored, token)
+	return apiModel.BatchLinkResult{Status: http.StatusOK, Link: &link}
+}
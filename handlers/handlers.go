@@ -1,18 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/alexadhy/shortener/analytics"
 	"github.com/alexadhy/shortener/apiModel"
 	"github.com/alexadhy/shortener/internal/log"
 	"github.com/alexadhy/shortener/model"
 	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/probe"
 	"github.com/alexadhy/shortener/render"
+	"github.com/alexadhy/shortener/shortcode"
+	"github.com/alexadhy/shortener/threat"
+	"github.com/alexadhy/shortener/urlnorm"
+	"github.com/didip/tollbooth/v6/limiter"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 // API  is the name of the object that will handle all routes
@@ -21,20 +34,111 @@ type API struct {
 	hostDomain       string
 	domainFilterFunc func(string) bool
 	expiry           time.Duration
+	minExpiry        time.Duration
+	maxExpiry        time.Duration
+	generator        shortcode.Generator
+	adminToken       string
+	analytics        *analytics.Recorder
+	redirectCode     int
+	pages            *template.Template
+	prelaunchURL     string
+	maxBatchSize     int
+	normalizer       *urlnorm.Normalizer
+	screener         *threat.Screener
+	checkRedirects   bool
+	aliasDomains     []string
+	ownHosts         map[string]bool
+	prober           *probe.Prober
+	trustedProxies   []*net.IPNet
+	passwordLimiter  *limiter.Limiter
+	linkLimiter      *limiter.Limiter
+}
+
+// Option configures optional behaviour of the API
+type Option func(a *API)
+
+// WithGenerator sets the generator used to derive short codes, defaults to model.DefaultGenerator
+func WithGenerator(g shortcode.Generator) Option {
+	return func(a *API) {
+		a.generator = g
+	}
+}
+
+// WithAdminToken sets the bearer token required by the /api endpoints, they are disabled without it
+// the admin token is also allowed to update or delete any link
+func WithAdminToken(token string) Option {
+	return func(a *API) {
+		a.adminToken = token
+	}
+}
+
+// WithAnalytics records every redirect with rec, and enables the stats endpoint
+func WithAnalytics(rec *analytics.Recorder) Option {
+	return func(a *API) {
+		a.analytics = rec
+	}
+}
+
+// WithRedirectCode sets the status code of redirects for links which don't have their own, defaults to 301
+func WithRedirectCode(code int) Option {
+	return func(a *API) {
+		a.redirectCode = code
+	}
+}
+
+// WithNormalizer sets how the submitted URLs are validated and canonicalized, defaults to http and https URLs
+// with their query and fragment kept as is
+func WithNormalizer(n *urlnorm.Normalizer) Option {
+	return func(a *API) {
+		a.normalizer = n
+	}
+}
+
+// WithExpiryBounds restricts the expiry clients can ask for, links can't be created without expiry if max is set
+func WithExpiryBounds(min, max time.Duration) Option {
+	return func(a *API) {
+		a.minExpiry = min
+		a.maxExpiry = max
+	}
 }
 
 // New creates a new instance of the API
 // hostDomain has to be in the form of {SCHEME}://{DOMAIN}.{TLD}
+// defaultExpiry is used for links created without expiry, 0 means they never expire
 // domainFilterFn can be used to filter website we will shorten link to
-func New(p persist.Persist, hostDomain string, defaultExpiry time.Duration, domainFilterFn func(s string) bool) API {
-	return API{p: p, hostDomain: hostDomain, expiry: defaultExpiry, domainFilterFunc: domainFilterFn}
+func New(p persist.Persist, hostDomain string, defaultExpiry time.Duration, domainFilterFn func(s string) bool, opts ...Option) API {
+	a := API{p: p, hostDomain: hostDomain, expiry: defaultExpiry, domainFilterFunc: domainFilterFn, generator: model.DefaultGenerator, redirectCode: http.StatusMovedPermanently, pages: defaultPages, maxBatchSize: defaultMaxBatchSize, normalizer: urlnorm.New(urlnorm.Options{})}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	if a.passwordLimiter == nil {
+		a.passwordLimiter, a.linkLimiter = newPasswordLimiters(defaultPasswordAttempts, defaultPasswordPeriod)
+	}
+	a.ownHosts = ownHosts(hostDomain, a.aliasDomains)
+	return a
+}
+
+// Routes registers the endpoints of the API on r
+func (a *API) Routes(r chi.Router) {
+	r.Post("/", a.CreateShortLink)
+	r.Get("/{id}", a.HandleRedirect)
+	r.Get("/{id}+", a.LinkInfo)
+	r.Post("/{id}", a.HandleRedirect)
+	r.Patch("/{id}", a.UpdateShortLink)
+	r.Delete("/{id}", a.DeleteShortLink)
+	r.Get("/api/links", a.ListLinks)
+	r.Post("/api/links/batch", a.CreateShortLinks)
+	r.Get("/api/links/broken", a.BrokenLinks)
+	r.Get("/api/links/{id}", a.LinkInfo)
+	r.Get("/api/links/{id}/stats", a.LinkStats)
+	r.Get("/debug/vars", a.DebugVars)
 }
 
 // CreateShortLink will create short link from original URL
 // will return the same shortened url if it already has one
 func (a *API) CreateShortLink(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		handleErr(http.StatusBadRequest, errors.New("invalid request method"), w)
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
 		return
 	}
 
@@ -42,69 +146,453 @@ func (a *API) CreateShortLink(w http.ResponseWriter, r *http.Request) {
 
 	var body apiModel.CreateShortLinkRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		_, _ = render.Render(render.Response[any]{StatusCode: http.StatusBadRequest, Err: err}, w)
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidBody, err)
 		return
 	}
 
-	u, err := url.Parse(body.OriginalURL)
-	if err != nil {
-		_, _ = render.Render(render.Response[any]{StatusCode: http.StatusBadRequest, Err: err}, w)
+	shortData, token, status, rerr := a.newLink(r.Context(), body)
+	if rerr != nil {
+		_, _ = render.RenderError(w, r, status, rerr)
 		return
 	}
 
-	if !a.domainFilterFunc(u.Host) {
-		_, _ = render.Render(render.Response[any]{StatusCode: http.StatusBadRequest, Err: errors.New("non-whitelisted domain")}, w)
-		return
+	if a.prober != nil {
+		if status, rerr = a.probe(r.Context(), shortData); rerr != nil {
+			_, _ = render.RenderError(w, r, status, rerr)
+			return
+		}
 	}
 
-	shortData, err := model.New(body.OriginalURL, a.expiry)
-	if err != nil {
-		_, _ = render.Render(render.Response[any]{StatusCode: http.StatusBadRequest, Err: err}, w)
+	if err := persist.Save(r.Context(), a.p, shortData, a.generator); err != nil {
+		if errors.Is(err, persist.ErrAliasTaken) {
+			handleErr(w, r, http.StatusConflict, apiModel.CodeAliasTaken, err)
+			return
+		}
+		log.Errorf("CreateShortLink() Set: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
 		return
 	}
 
-	if err := a.p.Set(r.Context(), shortData); err != nil {
+	shortData, err := a.p.Get(r.Context(), shortData.Short)
+	if err != nil {
 		log.Errorf("CreateShortLink() Get: %v", err)
-		handleErr(http.StatusInternalServerError, errors.New("internal error"), w)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
 		return
 	}
-
-	shortData, err = a.p.Get(r.Context(), shortData.Short)
-	if err != nil {
-		log.Errorf("CreateShortLink() Get: %v", err)
-		handleErr(http.StatusInternalServerError, errors.New("internal error"), w)
+	if err = a.share(r.Context(), shortData, token); err != nil {
+		log.Errorf("CreateShortLink() share: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
 		return
 	}
 
-	// construct short link url
-	shortURL := a.hostDomain + "/" + shortData.Short
 	_, _ = render.Render(
 		render.Response[any]{
 			StatusCode: http.StatusOK,
-			Data:       apiModel.CreateShortLinkResponse{ShortLinkURL: shortURL},
+			Data:       a.createdLink(shortData, token),
 		}, w,
 	)
 }
 
+// internalError is the error clients get when something went wrong on our side, the cause is only logged
+func internalError() *render.Error {
+	return render.NewError(apiModel.CodeInternal, errors.New("internal error"))
+}
+
+// newLink validates body and returns the link it asks for along with its manage token
+// the status code and the error to answer with are returned if body is invalid
+func (a *API) newLink(ctx context.Context, body apiModel.CreateShortLinkRequest) (*model.ShortenedData, string, int, *render.Error) {
+	// canonicalized first, so that the different spellings of a URL are deduplicated
+	var status int
+	var rerr *render.Error
+	if body.OriginalURL, status, rerr = a.checkURL(ctx, "url", body.OriginalURL, ""); rerr != nil {
+		return nil, "", status, rerr
+	}
+
+	if body.Fallback != "" {
+		if body.Fallback, status, rerr = a.checkURL(ctx, "fallback_url", body.Fallback, ""); rerr != nil {
+			return nil, "", status, rerr
+		}
+	}
+
+	if err := model.ValidateRedirectCode(body.RedirectCode); err != nil {
+		return nil, "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidRedirect, err)
+	}
+
+	if body.Prelaunch != "" {
+		if body.Prelaunch, status, rerr = a.checkURL(ctx, "prelaunch_url", body.Prelaunch, ""); rerr != nil {
+			return nil, "", status, rerr
+		}
+	}
+
+	if body.MaxUses < 0 {
+		return nil, "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidMaxUses, errors.New("max_uses can't be negative"))
+	}
+
+	ttl, err := a.linkTTL(body)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidExpiry, err)
+	}
+
+	var shortData *model.ShortenedData
+	if body.Alias != "" {
+		shortData, err = model.NewAlias(body.OriginalURL, body.Alias, ttl)
+		if err != nil {
+			return nil, "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidAlias, err)
+		}
+	} else {
+		shortData, err = model.NewWithGenerator(body.OriginalURL, ttl, a.generator)
+		if err != nil {
+			log.Errorf("newLink() NewWithGenerator: %v", err)
+			return nil, "", http.StatusInternalServerError, internalError()
+		}
+	}
+
+	shortData.RedirectCode = body.RedirectCode
+	shortData.Fallback = body.Fallback
+	shortData.Rehash()
+	if err = shortData.SetPassword(body.Password); err != nil {
+		return nil, "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidPassword, err)
+	}
+	if body.ExpiresAt != nil {
+		shortData.Expiry = body.ExpiresAt.UTC()
+	}
+	if err = schedule(shortData, body); err != nil {
+		return nil, "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidSchedule, err)
+	}
+	shortData.MaxUses = body.MaxUses
+	// neither a limited nor a scheduled link can be handed out in place of another one,
+	// nor one whose expiry was asked for, the existing link would keep its own
+	if shortData.Limited() || !shortData.NotBefore.IsZero() || explicitExpiry(body) {
+		if err = shortData.MakeUnique(); err != nil {
+			log.Errorf("newLink() MakeUnique: %v", err)
+			return nil, "", http.StatusInternalServerError, internalError()
+		}
+	}
+
+	if shortData.Distinct() && !shortData.Custom {
+		if err = shortData.Regenerate(a.generator, 0); err != nil {
+			log.Errorf("newLink() Regenerate: %v", err)
+			return nil, "", http.StatusInternalServerError, internalError()
+		}
+	}
+
+	token, err := shortData.NewOwnerToken()
+	if err != nil {
+		log.Errorf("newLink() NewOwnerToken: %v", err)
+		return nil, "", http.StatusInternalServerError, internalError()
+	}
+	return shortData, token, 0, nil
+}
+
+// createdLink returns the response to the creation of sd as stored
+// the token is only handed out if the request created the link, not if it already existed
+func (a *API) createdLink(sd *model.ShortenedData, token string) apiModel.CreateShortLinkResponse {
+	resp := apiModel.CreateShortLinkResponse{
+		ShortLinkURL: a.hostDomain + "/" + sd.Short,
+		ExpiresAt:    expiresAt(sd),
+		NotBefore:    notBefore(sd),
+	}
+	if sd.IsOwner(token) {
+		resp.ManageToken = token
+	}
+	return resp
+}
+
+// share marks sd as shared if it is handed out in place of a new link, i.e. token isn't the one of its owner
+// the owner can't change its destination from then on, it would change the link of everyone it was handed out to
+func (a *API) share(ctx context.Context, sd *model.ShortenedData, token string) error {
+	if sd.Shared || sd.IsOwner(token) {
+		return nil
+	}
+	_, err := a.p.Update(ctx, sd.Key, func(data *model.ShortenedData) error {
+		data.Shared = true
+		return nil
+	})
+	return err
+}
+
+// HandleRedirect redirects to the destination of the short link
+// protected links are also requested with POST by the password form served to browsers
 func (a *API) HandleRedirect(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		handleErr(http.StatusBadRequest, errors.New("invalid request method"), w)
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
 		return
 	}
 
 	// get the shortened link
 	key := chi.URLParam(r, "id")
 	sd, err := a.p.Get(r.Context(), key)
-	if err != nil {
-		handleErr(http.StatusNotFound, errors.New("invalid link provider"), w)
+	switch {
+	case err == nil:
+	case errors.Is(err, persist.ErrExpired) && sd.Fallback != "" && sd.Blocked == "":
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, sd.Fallback, http.StatusFound)
+		return
+	case errors.Is(err, persist.ErrExpired):
+		a.renderPage(w, r, http.StatusGone, "expired.html", page{
+			Title:   "This link has expired",
+			Message: "The short link you followed has expired and no longer points anywhere.",
+			Short:   a.hostDomain + "/" + key,
+		}, apiModel.CodeExpired, errors.New("link has expired"))
+		return
+	case errors.Is(err, persist.ErrNotFound):
+		a.renderPage(w, r, http.StatusNotFound, "expired.html", page{
+			Title:   "This link doesn't exist",
+			Message: "The short link you followed may have expired or been removed.",
+			Short:   a.hostDomain + "/" + key,
+		}, apiModel.CodeNotFound, errors.New("invalid link provider"))
+		return
+	default:
+		log.Errorf("HandleRedirect() Get: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	if a.screen(r, sd) {
+		a.blocked(w, r, sd)
+		return
+	}
+
+	if !sd.ActiveAt(time.Now()) {
+		a.notYetActive(w, r, sd)
+		return
+	}
+
+	if sd.Protected() && !a.unlock(w, r, sd) {
+		return
+	}
+
+	if sd.Limited() && !a.consume(w, r, sd) {
 		return
 	}
 
-	http.Redirect(w, r, sd.Orig, http.StatusMovedPermanently)
+	if a.analytics != nil {
+		a.analytics.Record(analytics.Event{
+			Time:      time.Now().UTC(),
+			Key:       sd.Key,
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			ClientIP:  analytics.AnonymizeIP(a.clientIP(r)),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+	}
+
+	code := sd.RedirectCode
+	if code == 0 {
+		code = a.redirectCode
+	}
+	cc := cacheControl(code, sd.Expiry)
+	if sd.Protected() || sd.Limited() {
+		// a cached redirect would skip the password, or wouldn't be counted
+		cc = "no-store"
+	}
+	if r.Method == http.MethodPost {
+		// 307 and 308 would repeat the POST of the password form to the destination
+		code = http.StatusSeeOther
+	}
+	w.Header().Set("Cache-Control", cc)
+	http.Redirect(w, r, sd.Orig, code)
 }
 
-func handleErr(statusCode int, err error, w http.ResponseWriter) {
-	_, _ = render.Render(
-		render.Response[any]{StatusCode: statusCode, Err: err}, w,
-	)
+// maxRedirectCacheAge is how long permanent redirects of links without expiry can be cached
+const maxRedirectCacheAge = 365 * 24 * time.Hour
+
+// cacheControl returns the Cache-Control header of a redirect
+// temporary redirects are never cached, permanent ones only until the link expires
+func cacheControl(code int, expiry time.Time) string {
+	if !model.IsPermanentRedirect(code) {
+		return "no-store"
+	}
+	ttl := maxRedirectCacheAge
+	if !expiry.IsZero() {
+		ttl = time.Until(expiry)
+	}
+	if ttl <= 0 {
+		return "no-store"
+	}
+	return "public, max-age=" + strconv.Itoa(int(ttl.Seconds()))
+}
+
+// linkTTL returns how long the link requested in body is valid for, 0 means it never expires
+// the server default is used unless the request asks for something else
+func (a *API) linkTTL(body apiModel.CreateShortLinkRequest) (time.Duration, error) {
+	set := 0
+	for _, ok := range []bool{body.TTL != 0, body.ExpiresAt != nil, body.NeverExpire} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return 0, errors.New("only one of ttl, expires_at and never_expire can be set")
+	}
+
+	switch {
+	case body.NeverExpire:
+		return 0, a.checkExpiry(0)
+	case body.ExpiresAt != nil:
+		ttl := time.Until(*body.ExpiresAt)
+		if ttl <= 0 {
+			return 0, errors.New("expiry has to be in the future")
+		}
+		return ttl, a.checkExpiry(ttl)
+	case body.TTL != 0:
+		if body.TTL < 0 {
+			return 0, errors.New("ttl has to be positive")
+		}
+		ttl := time.Duration(body.TTL) * time.Second
+		return ttl, a.checkExpiry(ttl)
+	default:
+		return a.expiry, nil
+	}
+}
+
+// explicitExpiry reports whether body asks for its own expiry rather than the default one
+func explicitExpiry(body apiModel.CreateShortLinkRequest) bool {
+	return body.TTL != 0 || body.ExpiresAt != nil || body.NeverExpire
+}
+
+// checkExpiry checks ttl against the configured bounds, 0 means the link never expires
+func (a *API) checkExpiry(ttl time.Duration) error {
+	if ttl == 0 {
+		if a.maxExpiry > 0 {
+			return fmt.Errorf("links have to expire within %s", a.maxExpiry)
+		}
+		return nil
+	}
+	if ttl < a.minExpiry {
+		return fmt.Errorf("expiry has to be at least %s", a.minExpiry)
+	}
+	if a.maxExpiry > 0 && ttl > a.maxExpiry {
+		return fmt.Errorf("expiry has to be at most %s", a.maxExpiry)
+	}
+	return nil
+}
+
+// expiresAt returns the expiry of sd, nil if it never expires
+func expiresAt(sd *model.ShortenedData) *time.Time {
+	if sd.Expiry.IsZero() {
+		return nil
+	}
+	return &sd.Expiry
+}
+
+// consume counts a use of a limited link, the request is answered with 410 Gone and false is returned once it is used up
+func (a *API) consume(w http.ResponseWriter, r *http.Request, sd *model.ShortenedData) bool {
+	err := model.ErrUsedUp
+	if !sd.UsedUp() {
+		_, err = a.p.Update(r.Context(), sd.Key, (*model.ShortenedData).Consume)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, model.ErrUsedUp):
+		a.renderPage(w, r, http.StatusGone, "expired.html", page{
+			Title:   "This link has been used up",
+			Message: "The short link you followed could only be used a limited number of times.",
+			Short:   a.hostDomain + "/" + sd.Key,
+		}, apiModel.CodeUsedUp, err)
+	case errors.Is(err, persist.ErrNotFound):
+		handleErr(w, r, http.StatusNotFound, apiModel.CodeNotFound, errors.New("invalid link provider"))
+	default:
+		log.Errorf("HandleRedirect() Update: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+	}
+	return false
+}
+
+// WithTrustedProxies sets the reverse proxies whose X-Forwarded-For and X-Real-IP headers are trusted
+// the headers are ignored by default, they can be set by any client
+func WithTrustedProxies(nets ...*net.IPNet) Option {
+	return func(a *API) {
+		a.trustedProxies = nets
+	}
+}
+
+// clientIP returns the address of the client, the forwarding headers are only read from the trusted proxies
+// X-Forwarded-For is walked from the right, the first address which isn't a trusted proxy is the client
+func (a *API) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !a.trusted(host) {
+		return host
+	}
+
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		hops := strings.Split(fwd, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if !a.trusted(hop) {
+				return hop
+			}
+			host = hop
+		}
+		return host
+	}
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); real != "" {
+		return real
+	}
+	return host
+}
+
+// trusted reports whether addr is one of the trusted proxies
+func (a *API) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkURL validates a destination URL before it is shortened and returns its canonical form, see urlnorm
+// field is the request field it comes from, the domain filter is given the host of the canonical URL without port
+// our own short links are replaced by their destination, key is the link being retargeted if any, see resolveSelfLink
+// the status code to answer with is returned along with the error
+func (a *API) checkURL(ctx context.Context, field, orig, key string) (string, int, *render.Error) {
+	norm, err := a.normalizer.Normalize(orig)
+	if err != nil {
+		return "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidURL, err).
+			WithDetails(map[string]string{"field": field})
+	}
+	u, err := url.Parse(norm)
+	if err != nil {
+		return "", http.StatusBadRequest, render.NewError(apiModel.CodeInvalidURL, err).
+			WithDetails(map[string]string{"field": field})
+	}
+
+	if a.ownHosts[u.Host] {
+		// the resolved destination is checked again, the lists may have changed since it was stored
+		var status int
+		var rerr *render.Error
+		if norm, status, rerr = a.resolveSelfLink(ctx, field, u, key); rerr != nil {
+			return "", status, rerr
+		}
+		if u, err = url.Parse(norm); err != nil {
+			log.Errorf("checkURL() Parse: %v", err)
+			return "", http.StatusInternalServerError, internalError()
+		}
+	}
+
+	if !a.domainFilterFunc(u.Hostname()) {
+		return "", http.StatusBadRequest, render.NewError(apiModel.CodeDeniedDomain, errors.New("non-whitelisted domain")).
+			WithDetails(map[string]string{"field": field, "host": u.Hostname()})
+	}
+	if a.screener != nil {
+		if m, ok := a.screener.Check(norm); ok {
+			return "", http.StatusBadRequest, render.NewError(apiModel.CodeUnsafeURL, errors.New("destination is listed as unsafe")).
+				WithDetails(map[string]string{"field": field, "list": m.List, "entry": m.Entry})
+		}
+	}
+	return norm, 0, nil
+}
+
+// handleErr renders err in the error envelope, with the machine-readable code
+func handleErr(w http.ResponseWriter, r *http.Request, statusCode int, code string, err error) {
+	_, _ = render.RenderError(w, r, statusCode, render.NewError(code, err))
 }
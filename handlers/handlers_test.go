@@ -0,0 +1,1660 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/analytics"
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/handlers"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/persist/memory"
+	"github.com/alexadhy/shortener/probe"
+	"github.com/alexadhy/shortener/render"
+	"github.com/alexadhy/shortener/threat"
+	"github.com/alexadhy/shortener/urlnorm"
+)
+
+const testDomain = "http://sho.rt"
+
+func bootstrapAPI(t *testing.T, opts ...handlers.Option) http.Handler {
+	t.Helper()
+	return bootstrapAPIWithStore(t, memory.New(), opts...)
+}
+
+func bootstrapAPIWithStore(t *testing.T, p persist.Persist, opts ...handlers.Option) http.Handler {
+	t.Helper()
+	api := handlers.New(p, testDomain, time.Hour, func(s string) bool {
+		return s != "blocked.example.com"
+	}, opts...)
+
+	router := chi.NewRouter()
+	api.Routes(router)
+	return router
+}
+
+type response struct {
+	Data  map[string]any `json:"data"`
+	Error *render.Error  `json:"error"`
+}
+
+func do(t *testing.T, h http.Handler, method, target, body string, headers map[string]string) (*httptest.ResponseRecorder, response) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp response
+	if rec.Body.Len() > 0 && strings.HasPrefix(rec.Body.String(), "{") {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response body %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, resp
+}
+
+func TestCreateShortLink(t *testing.T) {
+	h := bootstrapAPI(t)
+	_, taken := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/taken", "alias": "taken"}`, nil)
+	assert.Equal(t, testDomain+"/taken", taken.Data["url"])
+
+	cases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantURL    string
+		wantToken  bool
+	}{
+		{
+			name:       "should shorten a valid url",
+			body:       `{"url": "https://example.com/a"}`,
+			wantStatus: http.StatusOK,
+			wantToken:  true,
+		},
+		{
+			name:       "should return the same short link without a manage token for an existing url",
+			body:       `{"url": "https://example.com/a"}`,
+			wantStatus: http.StatusOK,
+			wantToken:  false,
+		},
+		{
+			name:       "should accept a custom alias",
+			body:       `{"url": "https://example.com/q3.pdf", "alias": "q3-report"}`,
+			wantStatus: http.StatusOK,
+			wantURL:    testDomain + "/q3-report",
+			wantToken:  true,
+		},
+		{
+			name:       "should reject an alias used by another url",
+			body:       `{"url": "https://example.com/other", "alias": "taken"}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "should reject a reserved alias",
+			body:       `{"url": "https://example.com/other", "alias": "api"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject filtered domains",
+			body:       `{"url": "https://blocked.example.com/"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject invalid json",
+			body:       `{"url": `,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodPost, "/", tt.body, nil)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if tt.wantURL != "" {
+				assert.Equal(t, tt.wantURL, resp.Data["url"])
+			}
+			_, hasToken := resp.Data["manage_token"]
+			assert.Equal(t, tt.wantToken, hasToken)
+		})
+	}
+}
+
+func TestManageShortLink(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithAdminToken("admin-secret"))
+	_, created := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/doc", "alias": "doc"}`, nil)
+	token, _ := created.Data["manage_token"].(string)
+	assert.NotEmpty(t, token)
+
+	rec, _ := do(t, h, http.MethodGet, "/doc", "", nil)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "https://example.com/doc", rec.Header().Get("Location"))
+
+	cases := []struct {
+		name       string
+		method     string
+		body       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "should not update without a token",
+			method:     http.MethodPatch,
+			body:       `{"url": "https://example.com/leaked"}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "should not update with a wrong token",
+			method:     http.MethodPatch,
+			body:       `{"url": "https://example.com/leaked"}`,
+			token:      "wrong",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should update with the manage token",
+			method:     http.MethodPatch,
+			body:       `{"url": "https://example.com/retargeted"}`,
+			token:      token,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should not list links with the manage token",
+			method:     http.MethodGet,
+			token:      token,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "should delete with the admin token",
+			method:     http.MethodDelete,
+			token:      "admin-secret",
+			wantStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/doc"
+			if tt.method == http.MethodGet {
+				target = "/api/links"
+			}
+			headers := map[string]string{}
+			if tt.token != "" {
+				headers["Authorization"] = "Bearer " + tt.token
+			}
+			rec, _ := do(t, h, tt.method, target, tt.body, headers)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+
+	rec, _ = do(t, h, http.MethodGet, "/doc", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSharedLink(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithAdminToken("admin-secret"))
+	_, first := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/shared"}`, nil)
+	owner := map[string]string{"Authorization": "Bearer " + stringOf(first.Data["manage_token"])}
+	target := strings.TrimPrefix(stringOf(first.Data["url"]), testDomain)
+
+	_, second := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/shared"}`, nil)
+	assert.Equal(t, first.Data["url"], second.Data["url"])
+	assert.Empty(t, second.Data["manage_token"])
+
+	for _, body := range []string{`{"url": "https://example.com/hijacked"}`, `{"fallback_url": "https://example.com/hijacked"}`} {
+		rec, resp := do(t, h, http.MethodPatch, target, body, owner)
+		assert.Equal(t, http.StatusConflict, rec.Code, body)
+		assert.Equal(t, apiModel.CodeSharedLink, resp.Error.Code)
+	}
+	rec, _ := do(t, h, http.MethodGet, target, "", nil)
+	assert.Equal(t, "https://example.com/shared", rec.Header().Get("Location"))
+
+	// the expiry can still be changed by the owner, and the destination by the admin
+	rec, _ = do(t, h, http.MethodPatch, target, `{"expires_at": "`+time.Now().Add(2*time.Hour).UTC().Format(time.RFC3339)+`"}`, owner)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec, _ = do(t, h, http.MethodPatch, target, `{"url": "https://example.com/moved"}`, map[string]string{"Authorization": "Bearer admin-secret"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec, _ = do(t, h, http.MethodGet, target, "", nil)
+	assert.Equal(t, "https://example.com/moved", rec.Header().Get("Location"))
+}
+
+func TestListLinks(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithAdminToken("admin-secret"))
+	created := map[string]bool{}
+	var token string
+	for _, alias := range []string{"alpha", "bravo", "charlie", "delta", "echo"} {
+		_, resp := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/`+alias+`", "alias": "`+alias+`"}`, nil)
+		token = stringOf(resp.Data["manage_token"])
+		created[alias] = true
+	}
+	admin := map[string]string{"Authorization": "Bearer admin-secret"}
+
+	cases := []struct {
+		name       string
+		target     string
+		headers    map[string]string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "should require a token", target: "/api/links", wantStatus: http.StatusUnauthorized, wantCode: apiModel.CodeUnauthorized},
+		{name: "should refuse a manage token", target: "/api/links", headers: map[string]string{"Authorization": "Bearer " + token}, wantStatus: http.StatusForbidden, wantCode: apiModel.CodeForbidden},
+		{name: "should list with the admin token", target: "/api/links", headers: admin, wantStatus: http.StatusOK},
+		{name: "should reject a zero limit", target: "/api/links?limit=0", headers: admin, wantStatus: http.StatusBadRequest, wantCode: apiModel.CodeInvalidQuery},
+		{name: "should reject a negative limit", target: "/api/links?limit=-1", headers: admin, wantStatus: http.StatusBadRequest, wantCode: apiModel.CodeInvalidQuery},
+		{name: "should reject a limit above the maximum", target: "/api/links?limit=1001", headers: admin, wantStatus: http.StatusBadRequest, wantCode: apiModel.CodeInvalidQuery},
+		{name: "should reject an invalid limit", target: "/api/links?limit=all", headers: admin, wantStatus: http.StatusBadRequest, wantCode: apiModel.CodeInvalidQuery},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodGet, tt.target, "", tt.headers)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, tt.wantCode, resp.Error.Code)
+				return
+			}
+			links, _ := resp.Data["links"].([]any)
+			assert.Len(t, links, len(created))
+			assert.Empty(t, resp.Data["next_cursor"])
+		})
+	}
+
+	t.Run("should page with the cursor", func(t *testing.T) {
+		seen := map[string]bool{}
+		cursor := ""
+		pages := 0
+		for pages < 5 {
+			pages++
+			rec, resp := do(t, h, http.MethodGet, "/api/links?limit=2&cursor="+cursor, "", admin)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			links, _ := resp.Data["links"].([]any)
+			assert.LessOrEqual(t, len(links), 2)
+			for _, l := range links {
+				short := stringOf(l.(map[string]any)["short"])
+				assert.False(t, seen[short], "%s listed twice", short)
+				seen[short] = true
+			}
+			if cursor = stringOf(resp.Data["next_cursor"]); cursor == "" {
+				break
+			}
+		}
+		assert.Equal(t, 3, pages)
+		assert.Equal(t, created, seen)
+	})
+}
+
+func TestDebugVars(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithAdminToken("admin-secret"))
+	_, resp := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/vars"}`, nil)
+	token := stringOf(resp.Data["manage_token"])
+
+	cases := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "should require a token", wantStatus: http.StatusUnauthorized, wantCode: apiModel.CodeUnauthorized},
+		{name: "should refuse a manage token", headers: map[string]string{"Authorization": "Bearer " + token}, wantStatus: http.StatusForbidden, wantCode: apiModel.CodeForbidden},
+		{name: "should serve the variables with the admin token", headers: map[string]string{"Authorization": "Bearer admin-secret"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodGet, "/debug/vars", "", tt.headers)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, tt.wantCode, resp.Error.Code)
+				return
+			}
+			assert.Contains(t, rec.Body.String(), `"memstats"`)
+		})
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	h := bootstrapAPI(t)
+
+	cases := []struct {
+		name            string
+		body            string
+		accept          string
+		wantStatus      int
+		wantCode        string
+		wantContentType string
+	}{
+		{
+			name:            "should render the error envelope",
+			body:            `{"url": "https://example.com/a", "alias": "api"}`,
+			wantStatus:      http.StatusBadRequest,
+			wantCode:        apiModel.CodeInvalidAlias,
+			wantContentType: render.ContentTypeJSON,
+		},
+		{
+			name:            "should render problem details when asked for",
+			body:            `{"url": "https://blocked.example.com/"}`,
+			accept:          "application/problem+json, application/json;q=0.5",
+			wantStatus:      http.StatusBadRequest,
+			wantCode:        apiModel.CodeDeniedDomain,
+			wantContentType: render.ContentTypeProblem,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodPost, "/", tt.body, map[string]string{"Accept": tt.accept})
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+
+			if tt.wantContentType == render.ContentTypeJSON {
+				if assert.NotNil(t, resp.Error) {
+					assert.Equal(t, tt.wantCode, resp.Error.Code)
+					assert.NotEmpty(t, resp.Error.Message)
+				}
+				return
+			}
+
+			var problem render.Problem
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+			assert.Equal(t, tt.wantCode, problem.Code)
+			assert.Equal(t, tt.wantStatus, problem.Status)
+			assert.Equal(t, http.StatusText(tt.wantStatus), problem.Title)
+			assert.NotEmpty(t, problem.Detail)
+		})
+	}
+}
+
+func TestRedirectCode(t *testing.T) {
+	cases := []struct {
+		name             string
+		opts             []handlers.Option
+		body             string
+		wantCreateStatus int
+		wantStatus       int
+		wantCacheControl string
+	}{
+		{
+			name:             "should redirect permanently by default",
+			body:             `{"url": "https://example.com/a", "alias": "link"}`,
+			wantCreateStatus: http.StatusOK,
+			wantStatus:       http.StatusMovedPermanently,
+			wantCacheControl: "public, max-age=",
+		},
+		{
+			name:             "should use the default of the server",
+			opts:             []handlers.Option{handlers.WithRedirectCode(http.StatusTemporaryRedirect)},
+			body:             `{"url": "https://example.com/a", "alias": "link"}`,
+			wantCreateStatus: http.StatusOK,
+			wantStatus:       http.StatusTemporaryRedirect,
+			wantCacheControl: "no-store",
+		},
+		{
+			name:             "should use the code of the link",
+			opts:             []handlers.Option{handlers.WithRedirectCode(http.StatusTemporaryRedirect)},
+			body:             `{"url": "https://example.com/a", "alias": "link", "redirect_code": 308}`,
+			wantCreateStatus: http.StatusOK,
+			wantStatus:       http.StatusPermanentRedirect,
+			wantCacheControl: "public, max-age=",
+		},
+		{
+			name:             "should not cache temporary redirects",
+			body:             `{"url": "https://example.com/a", "alias": "link", "redirect_code": 302}`,
+			wantCreateStatus: http.StatusOK,
+			wantStatus:       http.StatusFound,
+			wantCacheControl: "no-store",
+		},
+		{
+			name:             "should reject other status codes",
+			body:             `{"url": "https://example.com/a", "alias": "link", "redirect_code": 303}`,
+			wantCreateStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			h := bootstrapAPI(t, tt.opts...)
+			rec, _ := do(t, h, http.MethodPost, "/", tt.body, nil)
+			assert.Equal(t, tt.wantCreateStatus, rec.Code)
+			if tt.wantCreateStatus != http.StatusOK {
+				return
+			}
+
+			rec, _ = do(t, h, http.MethodGet, "/link", "", nil)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, "https://example.com/a", rec.Header().Get("Location"))
+			assert.True(t, strings.HasPrefix(rec.Header().Get("Cache-Control"), tt.wantCacheControl), rec.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestRedirectCodeOfExistingLink(t *testing.T) {
+	h := bootstrapAPI(t)
+	_, plain := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a"}`, nil)
+
+	rec, found := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "redirect_code": 302}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, plain.Data["url"], found.Data["url"])
+
+	_, again := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "redirect_code": 302}`, nil)
+	assert.Equal(t, found.Data["url"], again.Data["url"])
+
+	for target, want := range map[string]int{
+		stringOf(plain.Data["url"]): http.StatusMovedPermanently,
+		stringOf(found.Data["url"]): http.StatusFound,
+	} {
+		rec, _ = do(t, h, http.MethodGet, strings.TrimPrefix(target, testDomain), "", nil)
+		assert.Equal(t, want, rec.Code, target)
+		assert.Equal(t, "https://example.com/a", rec.Header().Get("Location"))
+	}
+}
+
+func TestCreateShortLinkExpiry(t *testing.T) {
+	inADay := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	cases := []struct {
+		name       string
+		opts       []handlers.Option
+		body       string
+		wantStatus int
+		wantExpiry func(t *testing.T, expiresAt any)
+	}{
+		{
+			name:       "should use the default expiry",
+			body:       `{"url": "https://example.com/a"}`,
+			wantStatus: http.StatusOK,
+			wantExpiry: func(t *testing.T, expiresAt any) {
+				assert.WithinDuration(t, time.Now().Add(time.Hour), parseTime(t, expiresAt), time.Minute)
+			},
+		},
+		{
+			name:       "should accept a ttl",
+			body:       `{"url": "https://example.com/a", "ttl": 7200}`,
+			wantStatus: http.StatusOK,
+			wantExpiry: func(t *testing.T, expiresAt any) {
+				assert.WithinDuration(t, time.Now().Add(2*time.Hour), parseTime(t, expiresAt), time.Minute)
+			},
+		},
+		{
+			name:       "should accept an absolute expiry",
+			body:       `{"url": "https://example.com/a", "expires_at": "` + inADay.Format(time.RFC3339) + `"}`,
+			wantStatus: http.StatusOK,
+			wantExpiry: func(t *testing.T, expiresAt any) {
+				assert.Equal(t, inADay, parseTime(t, expiresAt))
+			},
+		},
+		{
+			name:       "should create links which never expire",
+			body:       `{"url": "https://example.com/a", "never_expire": true}`,
+			wantStatus: http.StatusOK,
+			wantExpiry: func(t *testing.T, expiresAt any) {
+				assert.Nil(t, expiresAt)
+			},
+		},
+		{
+			name:       "should reject links which never expire when there is a maximum",
+			opts:       []handlers.Option{handlers.WithExpiryBounds(time.Minute, 48*time.Hour)},
+			body:       `{"url": "https://example.com/a", "never_expire": true}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject a ttl above the maximum",
+			opts:       []handlers.Option{handlers.WithExpiryBounds(time.Minute, 48*time.Hour)},
+			body:       `{"url": "https://example.com/a", "ttl": 259200}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject a ttl below the minimum",
+			opts:       []handlers.Option{handlers.WithExpiryBounds(time.Hour, 0)},
+			body:       `{"url": "https://example.com/a", "ttl": 60}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject an expiry in the past",
+			body:       `{"url": "https://example.com/a", "expires_at": "2020-01-01T00:00:00Z"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject more than one expiry",
+			body:       `{"url": "https://example.com/a", "ttl": 7200, "never_expire": true}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			h := bootstrapAPI(t, tt.opts...)
+			rec, resp := do(t, h, http.MethodPost, "/", tt.body, nil)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, apiModel.CodeInvalidExpiry, resp.Error.Code)
+				return
+			}
+			tt.wantExpiry(t, resp.Data["expires_at"])
+
+			rec, _ = do(t, h, http.MethodGet, strings.TrimPrefix(resp.Data["url"].(string), testDomain), "", nil)
+			assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		})
+	}
+}
+
+func TestExpiryOfExistingLink(t *testing.T) {
+	h := bootstrapAPI(t)
+	_, first := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a"}`, nil)
+
+	for _, body := range []string{
+		`{"url": "https://example.com/a", "ttl": 7200}`,
+		`{"url": "https://example.com/a", "expires_at": "` + time.Now().Add(24*time.Hour).UTC().Format(time.RFC3339) + `"}`,
+		`{"url": "https://example.com/a", "never_expire": true}`,
+	} {
+		rec, resp := do(t, h, http.MethodPost, "/", body, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, body)
+		assert.NotEqual(t, first.Data["url"], resp.Data["url"], body)
+		assert.NotEqual(t, first.Data["expires_at"], resp.Data["expires_at"], body)
+	}
+
+	rec, resp := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "ttl": 7200}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), parseTime(t, resp.Data["expires_at"]), time.Minute)
+
+	// the first link keeps its default expiry
+	_, again := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a"}`, nil)
+	assert.Equal(t, first.Data["url"], again.Data["url"])
+	assert.Equal(t, first.Data["expires_at"], again.Data["expires_at"])
+}
+
+func TestFallbackOfExistingLink(t *testing.T) {
+	h := bootstrapAPI(t)
+	_, plain := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a"}`, nil)
+
+	rec, withFallback := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "fallback_url": "https://example.com/"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, plain.Data["url"], withFallback.Data["url"])
+
+	_, again := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "fallback_url": "https://example.com/"}`, nil)
+	assert.Equal(t, withFallback.Data["url"], again.Data["url"])
+
+	_, other := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "fallback_url": "https://example.com/other"}`, nil)
+	assert.NotEqual(t, withFallback.Data["url"], other.Data["url"])
+	assert.NotEqual(t, plain.Data["url"], other.Data["url"])
+
+	// a link given a fallback afterwards isn't handed out in place of the plain one anymore
+	headers := map[string]string{"Authorization": "Bearer " + stringOf(plain.Data["manage_token"])}
+	rec, _ = do(t, h, http.MethodPatch, strings.TrimPrefix(stringOf(plain.Data["url"]), testDomain), `{"fallback_url": "https://example.com/"}`, headers)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, replaced := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a"}`, nil)
+	assert.NotEqual(t, plain.Data["url"], replaced.Data["url"])
+}
+
+func parseTime(t *testing.T, v any) time.Time {
+	t.Helper()
+	s, _ := v.(string)
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatalf("invalid time %v: %v", v, err)
+	}
+	return ts
+}
+
+func TestExpiredLink(t *testing.T) {
+	h := bootstrapAPI(t)
+	expiresAt := time.Now().Add(50 * time.Millisecond).Format(time.RFC3339Nano)
+	var token string
+	for _, body := range []string{
+		`{"url": "https://example.com/sale", "alias": "sale", "expires_at": "` + expiresAt + `"}`,
+		`{"url": "https://example.com/promo", "alias": "promo", "expires_at": "` + expiresAt + `", "fallback_url": "https://example.com/"}`,
+	} {
+		rec, resp := do(t, h, http.MethodPost, "/", body, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		token = stringOf(resp.Data["manage_token"])
+	}
+
+	rec, _ := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "fallback_url": "https://blocked.example.com/"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	time.Sleep(60 * time.Millisecond)
+
+	cases := []struct {
+		name            string
+		target          string
+		accept          string
+		wantStatus      int
+		wantLocation    string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "should render the expired page for browsers",
+			target:          "/sale",
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			wantStatus:      http.StatusGone,
+			wantContentType: render.ContentTypeHTML,
+			wantBody:        "This link has expired",
+		},
+		{
+			name:            "should answer json to api clients",
+			target:          "/sale",
+			accept:          "application/json",
+			wantStatus:      http.StatusGone,
+			wantContentType: render.ContentTypeJSON,
+			wantBody:        apiModel.CodeExpired,
+		},
+		{
+			name:            "should render the missing page for browsers",
+			target:          "/missing",
+			accept:          "text/html",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: render.ContentTypeHTML,
+			wantBody:        "This link doesn&#39;t exist",
+		},
+		{
+			name:         "should redirect to the fallback url",
+			target:       "/promo",
+			accept:       "text/html",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := do(t, h, http.MethodGet, tt.target, "", map[string]string{"Accept": tt.accept})
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantLocation != "" {
+				assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+				assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+				return
+			}
+			assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+		})
+	}
+
+	t.Run("should let the owner delete a link kept for its fallback", func(t *testing.T) {
+		rec, _ := do(t, h, http.MethodDelete, "/promo", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec, _ = do(t, h, http.MethodDelete, "/promo", "", map[string]string{"Authorization": "Bearer " + token})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec, _ = do(t, h, http.MethodGet, "/promo", "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+// failingStore fails every Get with err
+type failingStore struct {
+	persist.Persist
+	err error
+}
+
+func (s failingStore) Get(context.Context, string) (*model.ShortenedData, error) {
+	return nil, s.err
+}
+
+func TestDeleteShortLinkStoreError(t *testing.T) {
+	h := bootstrapAPIWithStore(t, failingStore{Persist: memory.New(), err: errors.New("connection refused")})
+	rec, resp := do(t, h, http.MethodDelete, "/promo", "", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, apiModel.CodeInternal, resp.Error.Code)
+	assert.NotContains(t, rec.Body.String(), "connection refused")
+}
+
+func TestLoadPages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "expired.html"), []byte(`<p>custom: {{.Title}}</p>`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := handlers.LoadPages(dir)
+	assert.NoError(t, err)
+
+	h := bootstrapAPI(t, handlers.WithPages(pages))
+	rec, _ := do(t, h, http.MethodGet, "/missing", "", map[string]string{"Accept": "text/html"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "<p>custom: This link doesn&#39;t exist</p>", rec.Body.String())
+}
+
+func TestProtectedLink(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithPasswordAttempts(3, time.Hour))
+	_, created := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/internal", "alias": "internal", "password": "s3cret"}`, nil)
+	assert.NotEmpty(t, created.Data["manage_token"])
+
+	// the same url without a password is never deduplicated with the protected one
+	_, public := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/internal"}`, nil)
+	publicPath := strings.TrimPrefix(public.Data["url"].(string), testDomain)
+	rec, _ := do(t, h, http.MethodGet, publicPath, "", nil)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+
+	cases := []struct {
+		name         string
+		method       string
+		body         string
+		headers      map[string]string
+		wantStatus   int
+		wantBody     string
+		wantLocation string
+	}{
+		{
+			name:       "should serve the password form to browsers",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Accept": "text/html"},
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   `<form method="post">`,
+		},
+		{
+			name:       "should ask api clients for the password",
+			method:     http.MethodGet,
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   apiModel.CodePasswordRequired,
+		},
+		{
+			name:       "should reject a wrong password",
+			method:     http.MethodGet,
+			headers:    map[string]string{handlers.PasswordHeader: "guess"},
+			wantStatus: http.StatusForbidden,
+			wantBody:   apiModel.CodeInvalidPassword,
+		},
+		{
+			name:         "should redirect with the password in the header",
+			method:       http.MethodGet,
+			headers:      map[string]string{handlers.PasswordHeader: "s3cret"},
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com/internal",
+		},
+		{
+			name:         "should redirect with the password in the form",
+			method:       http.MethodPost,
+			body:         "password=s3cret",
+			headers:      map[string]string{"Content-Type": "application/x-www-form-urlencoded", "Accept": "text/html"},
+			wantStatus:   http.StatusSeeOther,
+			wantLocation: "https://example.com/internal",
+		},
+		{
+			name:       "should limit the attempts",
+			method:     http.MethodGet,
+			headers:    map[string]string{handlers.PasswordHeader: "s3cret"},
+			wantStatus: http.StatusTooManyRequests,
+			wantBody:   apiModel.CodeTooManyAttempts,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := do(t, h, tt.method, "/internal", tt.body, tt.headers)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			if tt.wantLocation != "" {
+				assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+				assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
+
+func TestPasswordAttemptsBehindProxy(t *testing.T) {
+	create := func(h http.Handler) {
+		rec, _ := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/vault", "alias": "vault", "password": "hunter2"}`, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	attempt := func(h http.Handler, fwd string) int {
+		rec, _ := do(t, h, http.MethodGet, "/vault", "", map[string]string{
+			handlers.PasswordHeader: "wrong",
+			"X-Forwarded-For":       fwd,
+		})
+		return rec.Code
+	}
+
+	// the headers of a client are ignored, rotating them doesn't get more attempts
+	h := bootstrapAPI(t, handlers.WithPasswordAttempts(3, time.Hour))
+	create(h)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusForbidden, attempt(h, "198.51.100."+strconv.Itoa(i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, attempt(h, "198.51.100.99"))
+
+	// behind a trusted proxy, the clients it forwards are told apart
+	_, proxy, err := net.ParseCIDR("192.0.2.0/24") // httptest.NewRequest comes from 192.0.2.1
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = bootstrapAPI(t, handlers.WithPasswordAttempts(3, time.Hour), handlers.WithTrustedProxies(proxy))
+	create(h)
+	for i := 0; i < 3; i++ {
+		// the leftmost address is set by the client, the proxy appends the one it saw
+		assert.Equal(t, http.StatusForbidden, attempt(h, "203.0.113."+strconv.Itoa(i)+", 198.51.100.7"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, attempt(h, "198.51.100.7"))
+	assert.Equal(t, http.StatusForbidden, attempt(h, "198.51.100.8"))
+}
+
+func TestPasswordAttemptsPerLink(t *testing.T) {
+	_, proxy, err := net.ParseCIDR("192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := bootstrapAPI(t, handlers.WithPasswordAttempts(3, time.Hour), handlers.WithTrustedProxies(proxy))
+	for _, alias := range []string{"vault", "safe"} {
+		rec, _ := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/`+alias+`", "alias": "`+alias+`", "password": "hunter2"}`, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+	attempt := func(target, client string) int {
+		rec, _ := do(t, h, http.MethodGet, target, "", map[string]string{
+			handlers.PasswordHeader: "wrong",
+			"X-Forwarded-For":       client,
+		})
+		return rec.Code
+	}
+
+	// clients with attempts left still run out of the attempts of the link, 30 for 3 per client
+	for i := 0; i < 30; i++ {
+		assert.Equal(t, http.StatusForbidden, attempt("/vault", "2001:db8::"+strconv.FormatInt(int64(i), 16)), i)
+	}
+	rec, _ := do(t, h, http.MethodGet, "/vault", "", map[string]string{
+		handlers.PasswordHeader: "hunter2",
+		"X-Forwarded-For":       "2001:db8::ffff",
+	})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// the other links keep their attempts
+	assert.Equal(t, http.StatusForbidden, attempt("/safe", "2001:db8::1"))
+}
+
+func TestLimitedLink(t *testing.T) {
+	h := bootstrapAPI(t)
+	rec, _ := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/invite", "max_uses": -1}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), apiModel.CodeInvalidMaxUses)
+
+	_, once := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/invite", "max_uses": 1}`, nil)
+	_, again := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/invite", "max_uses": 1}`, nil)
+	// every limited link counts its own uses
+	assert.NotEqual(t, once.Data["url"], again.Data["url"])
+
+	// they don't compete for the codes of their URL
+	seen := map[string]bool{}
+	for i := 0; i < 2*persist.MaxAttempts; i++ {
+		rec, resp := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/invite", "max_uses": 1}`, nil)
+		if !assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String()) {
+			break
+		}
+		short := strings.TrimPrefix(stringOf(resp.Data["url"]), testDomain+"/")
+		assert.Len(t, short, 8)
+		assert.False(t, seen[short], "duplicate code %s", short)
+		seen[short] = true
+	}
+
+	_, created := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/invite", "alias": "invite", "max_uses": 3}`, nil)
+	assert.NotEmpty(t, created.Data["manage_token"])
+
+	var wg sync.WaitGroup
+	var redirected, gone int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/invite", nil)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			switch rec.Code {
+			case http.StatusMovedPermanently:
+				assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+				atomic.AddInt32(&redirected, 1)
+			case http.StatusGone:
+				atomic.AddInt32(&gone, 1)
+			default:
+				t.Errorf("unexpected status %d: %s", rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), redirected)
+	assert.Equal(t, int32(7), gone)
+
+	rec, _ = do(t, h, http.MethodGet, "/invite", "", map[string]string{"Accept": "text/html"})
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, rec.Body.String(), "This link has been used up")
+	rec, _ = do(t, h, http.MethodGet, "/invite", "", nil)
+	assert.Contains(t, rec.Body.String(), apiModel.CodeUsedUp)
+}
+
+func TestScheduledLink(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithPrelaunchURL("https://example.com/soon"))
+	launch := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	past := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	create := []struct {
+		name          string
+		body          string
+		wantStatus    int
+		wantNotBefore bool
+	}{
+		{
+			name:          "should schedule a link",
+			body:          `{"url": "https://example.com/launch", "alias": "launch", "not_before": "` + launch.Format(time.RFC3339) + `"}`,
+			wantStatus:    http.StatusOK,
+			wantNotBefore: true,
+		},
+		{
+			name:          "should schedule a link with its own pre-launch url",
+			body:          `{"url": "https://example.com/launch", "alias": "teaser", "not_before": "` + launch.Format(time.RFC3339) + `", "prelaunch_url": "https://example.com/teaser"}`,
+			wantStatus:    http.StatusOK,
+			wantNotBefore: true,
+		},
+		{
+			name:       "should activate a link scheduled in the past right away",
+			body:       `{"url": "https://example.com/launch", "alias": "live", "not_before": "` + past + `"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "should reject a link starting after its expiry",
+			body:       `{"url": "https://example.com/launch", "ttl": 600, "not_before": "` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject a pre-launch url without schedule",
+			body:       `{"url": "https://example.com/launch", "prelaunch_url": "https://example.com/teaser"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "should reject a denied pre-launch url",
+			body:       `{"url": "https://example.com/launch", "not_before": "` + launch.Format(time.RFC3339) + `", "prelaunch_url": "https://blocked.example.com/"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range create {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodPost, "/", tt.body, nil)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if tt.wantNotBefore {
+				assert.True(t, launch.Equal(parseTime(t, resp.Data["not_before"])))
+			} else {
+				assert.Nil(t, resp.Data["not_before"])
+			}
+		})
+	}
+
+	// a scheduled link is never deduplicated with a live one
+	_, scheduled := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/launch", "not_before": "`+launch.Format(time.RFC3339)+`"}`, nil)
+	_, live := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/launch"}`, nil)
+	assert.NotEqual(t, scheduled.Data["url"], live.Data["url"])
+
+	redirect := []struct {
+		name         string
+		target       string
+		accept       string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{
+			name:         "should redirect to the server pre-launch url",
+			target:       "/launch",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/soon",
+		},
+		{
+			name:         "should redirect to the pre-launch url of the link",
+			target:       "/teaser",
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://example.com/teaser",
+		},
+		{
+			name:         "should redirect links scheduled in the past",
+			target:       "/live",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com/launch",
+		},
+	}
+	for _, tt := range redirect {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := do(t, h, http.MethodGet, tt.target, "", nil)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLocation, rec.Header().Get("Location"))
+		})
+	}
+
+	t.Run("should answer not yet available without pre-launch url", func(t *testing.T) {
+		h := bootstrapAPI(t)
+		do(t, h, http.MethodPost, "/", `{"url": "https://example.com/launch", "alias": "launch", "not_before": "`+launch.Format(time.RFC3339)+`"}`, nil)
+
+		rec, _ := do(t, h, http.MethodGet, "/launch", "", map[string]string{"Accept": "text/html"})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+		assert.Contains(t, rec.Body.String(), "This link isn&#39;t available yet")
+		assert.Contains(t, rec.Body.String(), launch.Format(time.RFC3339))
+
+		rec, _ = do(t, h, http.MethodGet, "/launch", "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Contains(t, rec.Body.String(), apiModel.CodeNotYetActive)
+	})
+}
+
+func TestLinkInfo(t *testing.T) {
+	h := bootstrapAPI(t)
+	do(t, h, http.MethodPost, "/", `{"url": "https://example.com/report", "alias": "report"}`, nil)
+	do(t, h, http.MethodPost, "/", `{"url": "https://example.com/internal", "alias": "internal", "password": "s3cret"}`, nil)
+	do(t, h, http.MethodPost, "/", `{"url": "https://example.com/launch", "alias": "launch", "not_before": "`+time.Now().Add(time.Hour).Format(time.RFC3339)+`"}`, nil)
+
+	cases := []struct {
+		name            string
+		target          string
+		accept          string
+		wantStatus      int
+		wantContentType string
+		wantOrig        string
+		wantBody        string
+	}{
+		{
+			name:            "should describe the link to api clients",
+			target:          "/api/links/report",
+			accept:          "application/json",
+			wantStatus:      http.StatusOK,
+			wantContentType: render.ContentTypeJSON,
+			wantOrig:        "https://example.com/report",
+		},
+		{
+			name:            "should describe the link with the bitly-style suffix",
+			target:          "/report+",
+			wantStatus:      http.StatusOK,
+			wantContentType: render.ContentTypeJSON,
+			wantOrig:        "https://example.com/report",
+		},
+		{
+			name:            "should render the preview page for browsers",
+			target:          "/report+",
+			accept:          "text/html",
+			wantStatus:      http.StatusOK,
+			wantContentType: render.ContentTypeHTML,
+			wantBody:        "<code>https://example.com/report</code>",
+		},
+		{
+			name:            "should not disclose the destination of protected links",
+			target:          "/api/links/internal",
+			wantStatus:      http.StatusOK,
+			wantContentType: render.ContentTypeJSON,
+			wantBody:        `"protected":true`,
+		},
+		{
+			name:            "should not disclose the destination of scheduled links",
+			target:          "/launch+",
+			accept:          "text/html",
+			wantStatus:      http.StatusOK,
+			wantContentType: render.ContentTypeHTML,
+			wantBody:        "Hidden until the link is available",
+		},
+		{
+			name:            "should answer not found for unknown links",
+			target:          "/api/links/missing",
+			wantStatus:      http.StatusNotFound,
+			wantContentType: render.ContentTypeJSON,
+			wantBody:        apiModel.CodeNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodGet, tt.target, "", map[string]string{"Accept": tt.accept})
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			assert.Empty(t, rec.Header().Get("Location"))
+			assert.Contains(t, rec.Body.String(), tt.wantBody)
+			assert.NotContains(t, rec.Body.String(), "s3cret")
+			if tt.wantContentType == render.ContentTypeJSON && rec.Code == http.StatusOK {
+				assert.Equal(t, tt.wantOrig, stringOf(resp.Data["original_url"]))
+				assert.NotEmpty(t, resp.Data["created_at"])
+				assert.NotEmpty(t, resp.Data["expires_at"])
+				assert.Nil(t, resp.Data["clicks"])
+			}
+		})
+	}
+
+	t.Run("should count the clicks when analytics are enabled", func(t *testing.T) {
+		store := memory.New()
+		recorder := analytics.NewRecorder(store, 0, time.Hour, nil)
+		defer recorder.Close()
+		api := handlers.New(store, testDomain, time.Hour, func(string) bool { return true }, handlers.WithAnalytics(recorder))
+		router := chi.NewRouter()
+		api.Routes(router)
+
+		do(t, router, http.MethodPost, "/", `{"url": "https://example.com/report", "alias": "report"}`, nil)
+		err := store.IncrClicks(context.Background(), "report", []model.ClickCount{
+			{Granularity: model.Daily, Start: model.BucketStart(time.Now(), model.Daily), Count: 3},
+		})
+		assert.Nil(t, err)
+
+		rec, resp := do(t, router, http.MethodGet, "/api/links/report", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, float64(3), resp.Data["clicks"])
+
+		rec, _ = do(t, router, http.MethodGet, "/api/links/report", "", map[string]string{"Accept": "text/html"})
+		assert.Contains(t, rec.Body.String(), "<dd>3</dd>")
+	})
+}
+
+func TestLinkStats(t *testing.T) {
+	store := memory.New()
+	recorder := analytics.NewRecorder(store, 0, time.Hour, nil)
+	h := bootstrapAPIWithStore(t, store, handlers.WithAnalytics(recorder), handlers.WithAdminToken("admin-secret"))
+
+	_, created := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/report", "alias": "report"}`, nil)
+	token := stringOf(created.Data["manage_token"])
+	for i := 0; i < 2; i++ {
+		rec, _ := do(t, h, http.MethodGet, "/report", "", nil)
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	}
+	yesterday := model.BucketStart(time.Now().Add(-24*time.Hour), model.Daily)
+	err := store.IncrClicks(context.Background(), "report", []model.ClickCount{
+		{Granularity: model.Daily, Start: yesterday, Count: 5},
+	})
+	assert.Nil(t, err)
+	// the pending counters are flushed on close, the stats are still read from the store
+	recorder.Close()
+
+	cases := []struct {
+		name       string
+		target     string
+		token      string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "should require a token", target: "/api/links/report/stats", wantStatus: http.StatusUnauthorized, wantCode: apiModel.CodeUnauthorized},
+		{name: "should refuse a wrong token", target: "/api/links/report/stats", token: "wrong", wantStatus: http.StatusForbidden, wantCode: apiModel.CodeForbidden},
+		{name: "should answer the manage token", target: "/api/links/report/stats", token: token, wantStatus: http.StatusOK},
+		{name: "should answer the admin token", target: "/api/links/report/stats", token: "admin-secret", wantStatus: http.StatusOK},
+		{name: "should not find unknown links", target: "/api/links/unknown/stats", token: "admin-secret", wantStatus: http.StatusNotFound, wantCode: apiModel.CodeNotFound},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.token != "" {
+				headers["Authorization"] = "Bearer " + tt.token
+			}
+			rec, resp := do(t, h, http.MethodGet, tt.target, "", headers)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				assert.Equal(t, tt.wantCode, resp.Error.Code)
+				return
+			}
+
+			assert.Equal(t, "report", resp.Data["short"])
+			assert.Equal(t, float64(7), resp.Data["total"])
+			daily, _ := resp.Data["daily"].([]any)
+			if assert.Len(t, daily, 2) {
+				// oldest first
+				assert.Equal(t, yesterday, parseTime(t, daily[0].(map[string]any)["start"]))
+				assert.Equal(t, float64(5), daily[0].(map[string]any)["count"])
+				assert.Equal(t, model.BucketStart(time.Now(), model.Daily), parseTime(t, daily[1].(map[string]any)["start"]))
+				assert.Equal(t, float64(2), daily[1].(map[string]any)["count"])
+			}
+			hourly, _ := resp.Data["hourly"].([]any)
+			if assert.Len(t, hourly, 1) {
+				assert.Equal(t, model.BucketStart(time.Now(), model.Hourly), parseTime(t, hourly[0].(map[string]any)["start"]))
+				assert.Equal(t, float64(2), hourly[0].(map[string]any)["count"])
+			}
+		})
+	}
+
+	t.Run("should not be found when analytics are disabled", func(t *testing.T) {
+		h := bootstrapAPIWithStore(t, store, handlers.WithAdminToken("admin-secret"))
+		rec, resp := do(t, h, http.MethodGet, "/api/links/report/stats", "", map[string]string{"Authorization": "Bearer admin-secret"})
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, apiModel.CodeDisabled, resp.Error.Code)
+	})
+}
+
+func stringOf(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func TestCreateShortLinks(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithAdminToken("admin-secret"), handlers.WithMaxBatchSize(4))
+	admin := map[string]string{"Authorization": "Bearer admin-secret"}
+	do(t, h, http.MethodPost, "/", `{"url": "https://example.com/q3-report.pdf", "alias": "q3-report"}`, nil)
+
+	rec, _ := do(t, h, http.MethodPost, "/api/links/batch", `[{"url": "https://example.com/a"}]`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec, resp := do(t, h, http.MethodPost, "/api/links/batch", `[{"url": "https://example.com/a"}, {"url": "https://example.com/b"}, {"url": "https://example.com/c"}, {"url": "https://example.com/d"}, {"url": "https://example.com/e"}]`, admin)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, apiModel.CodeBatchTooLarge, resp.Error.Code)
+
+	rec, resp = do(t, h, http.MethodPost, "/api/links/batch", `[]`, admin)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodeInvalidBody, resp.Error.Code)
+
+	rec, resp = do(t, h, http.MethodPost, "/api/links/batch", `[
+		{"url": "https://example.com/issue-42"},
+		{"url": "https://blocked.example.com/"},
+		{"url": "https://example.com/q4-report.pdf", "alias": "q3-report"},
+		{"url": "https://example.com/launch", "alias": "launch", "ttl": 3600}
+	]`, admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(2), resp.Data["created"])
+	assert.Equal(t, float64(2), resp.Data["failed"])
+
+	results, _ := resp.Data["results"].([]any)
+	if !assert.Len(t, results, 4) {
+		return
+	}
+	cases := []struct {
+		name       string
+		wantStatus int
+		wantCode   string
+		wantURL    string
+	}{
+		{name: "should create a link", wantStatus: http.StatusOK},
+		{name: "should report an invalid link", wantStatus: http.StatusBadRequest, wantCode: apiModel.CodeDeniedDomain},
+		{name: "should report a taken alias", wantStatus: http.StatusConflict, wantCode: apiModel.CodeAliasTaken},
+		{name: "should create a link with an alias", wantStatus: http.StatusOK, wantURL: testDomain + "/launch"},
+	}
+	for i, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _ := results[i].(map[string]any)
+			assert.Equal(t, float64(tt.wantStatus), res["status"])
+			if tt.wantCode != "" {
+				e, _ := res["error"].(map[string]any)
+				assert.Equal(t, tt.wantCode, e["code"])
+				assert.Nil(t, res["link"])
+				return
+			}
+			link, _ := res["link"].(map[string]any)
+			assert.NotEmpty(t, link["manage_token"])
+			if tt.wantURL != "" {
+				assert.Equal(t, tt.wantURL, link["url"])
+			}
+
+			path := strings.TrimPrefix(stringOf(link["url"]), testDomain)
+			rec, _ := do(t, h, http.MethodGet, path, "", nil)
+			assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		})
+	}
+}
+
+func TestCanonicalURL(t *testing.T) {
+	h := bootstrapAPI(t, handlers.WithNormalizer(urlnorm.New(urlnorm.Options{SortQuery: true})))
+
+	_, first := do(t, h, http.MethodPost, "/", `{"url": "HTTPS://Example.com:443?b=2&a=1"}`, nil)
+	_, second := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/?a=1&b=2"}`, nil)
+	assert.NotEmpty(t, first.Data["url"])
+	assert.Equal(t, first.Data["url"], second.Data["url"])
+	assert.Empty(t, second.Data["manage_token"])
+
+	rec, _ := do(t, h, http.MethodGet, strings.TrimPrefix(stringOf(first.Data["url"]), testDomain), "", nil)
+	assert.Equal(t, "https://example.com/?a=1&b=2", rec.Header().Get("Location"))
+
+	for _, orig := range []string{"", "javascript:alert(1)", "/relative", "example.com", "https:///no-host", "https://example.com@evil.example/"} {
+		t.Run("should refuse "+orig, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodPost, "/", `{"url": "`+orig+`"}`, nil)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, apiModel.CodeInvalidURL, resp.Error.Code)
+		})
+	}
+
+	// the domain filter is given the canonical host
+	rec, resp := do(t, h, http.MethodPost, "/", `{"url": "https://BLOCKED.example.com:8080/"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodeDeniedDomain, resp.Error.Code)
+
+	_, resp = do(t, h, http.MethodPost, "/", `{"url": "http://0x7f.1/admin"}`, nil)
+	rec, _ = do(t, h, http.MethodGet, strings.TrimPrefix(stringOf(resp.Data["url"]), testDomain), "", nil)
+	assert.Equal(t, "http://127.0.0.1/admin", rec.Header().Get("Location"))
+}
+
+func TestScreenedLink(t *testing.T) {
+	hosts := filepath.Join(t.TempDir(), "hosts.txt")
+	if err := os.WriteFile(hosts, []byte("phishing.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	screener, err := threat.New(threat.Options{HostFiles: []string{hosts}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer screener.Close()
+	h := bootstrapAPI(t, handlers.WithScreener(screener, true))
+
+	rec, resp := do(t, h, http.MethodPost, "/", `{"url": "https://Phishing.example/login"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodeUnsafeURL, resp.Error.Code)
+	assert.Contains(t, rec.Body.String(), "phishing.example")
+
+	rec, _ = do(t, h, http.MethodPost, "/", `{"url": "https://example.com/", "fallback_url": "https://phishing.example/"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	_, created := do(t, h, http.MethodPost, "/", `{"url": "https://example.org/promo", "alias": "promo"}`, nil)
+	assert.NotEmpty(t, created.Data["manage_token"])
+	rec, _ = do(t, h, http.MethodGet, "/promo", "", nil)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+
+	// listed after it was created, it is disabled the next time it is followed
+	if err = os.WriteFile(hosts, []byte("phishing.example\nexample.org\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = screener.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rec, resp = do(t, h, http.MethodGet, "/promo", "", nil)
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, apiModel.CodeBlocked, resp.Error.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec, _ = do(t, h, http.MethodGet, "/promo", "", map[string]string{"Accept": "text/html"})
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, rec.Body.String(), "This link has been disabled")
+
+	// it stays disabled once delisted
+	if err = os.WriteFile(hosts, []byte("phishing.example\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = screener.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = do(t, h, http.MethodGet, "/promo", "", nil)
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	_, info := do(t, h, http.MethodGet, "/api/links/promo", "", nil)
+	assert.Equal(t, true, info.Data["blocked"])
+	assert.Nil(t, info.Data["original_url"])
+}
+
+func TestSelfLink(t *testing.T) {
+	store := memory.New()
+	// chains stored before the domains were known as ours
+	for alias, orig := range map[string]string{
+		"hop1":  "http://sho.rt/hop2",
+		"hop2":  "https://go.example/hop3",
+		"hop3":  "https://example.com/end",
+		"loop1": "http://sho.rt/loop2",
+		"loop2": "http://sho.rt/loop1",
+		"long1": "http://sho.rt/long2",
+		"long2": "http://sho.rt/long3",
+		"long3": "http://sho.rt/long4",
+		"long4": "http://sho.rt/long5",
+		"long5": "http://sho.rt/long6",
+		"long6": "https://example.com/long",
+	} {
+		sd, err := model.NewAlias(orig, alias, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.Set(context.Background(), sd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := bootstrapAPIWithStore(t, store, handlers.WithAliasDomains("go.example"))
+
+	_, dest := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/a", "alias": "dest"}`, nil)
+	token := stringOf(dest.Data["manage_token"])
+	assert.NotEmpty(t, token)
+	_, secret := do(t, h, http.MethodPost, "/", `{"url": "https://example.com/secret", "alias": "secret", "password": "hunter2"}`, nil)
+	assert.NotEmpty(t, secret.Data["manage_token"])
+
+	tests := []struct {
+		name     string
+		body     string
+		location string
+		code     string
+	}{
+		{name: "should resolve a short link", body: `{"url": "HTTPS://sho.rt:443/dest", "alias": "via"}`, location: "https://example.com/a"},
+		{name: "should resolve an alias domain", body: `{"url": "https://go.example/dest", "alias": "via-alias"}`, location: "https://example.com/a"},
+		{name: "should follow a chain", body: `{"url": "http://sho.rt/hop1", "alias": "via-chain"}`, location: "https://example.com/end"},
+		{name: "should resolve the fallback", body: `{"url": "https://example.com/b", "fallback_url": "http://sho.rt/dest", "alias": "via-fallback"}`, location: "https://example.com/b"},
+		{name: "should refuse an unknown link", body: `{"url": "http://sho.rt/unknown"}`, code: apiModel.CodeSelfLink},
+		{name: "should refuse the info page", body: `{"url": "http://sho.rt/dest+"}`, code: apiModel.CodeSelfLink},
+		{name: "should refuse the api", body: `{"url": "http://sho.rt/api/links"}`, code: apiModel.CodeSelfLink},
+		{name: "should refuse the root", body: `{"url": "http://sho.rt/"}`, code: apiModel.CodeSelfLink},
+		{name: "should refuse a protected link", body: `{"url": "http://sho.rt/secret"}`, code: apiModel.CodeSelfLink},
+		{name: "should refuse a cycle", body: `{"url": "http://sho.rt/loop1"}`, code: apiModel.CodeRedirectLoop},
+		{name: "should refuse a long chain", body: `{"url": "http://sho.rt/long1"}`, code: apiModel.CodeRedirectLoop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, resp := do(t, h, http.MethodPost, "/", tt.body, nil)
+			if tt.code != "" {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				if assert.NotNil(t, resp.Error) {
+					assert.Equal(t, tt.code, resp.Error.Code)
+				}
+				return
+			}
+			assert.Equal(t, http.StatusOK, rec.Code)
+			rec, _ = do(t, h, http.MethodGet, strings.TrimPrefix(stringOf(resp.Data["url"]), testDomain), "", nil)
+			assert.Equal(t, tt.location, rec.Header().Get("Location"))
+		})
+	}
+
+	// a link can't be retargeted to itself, even through other links
+	auth := map[string]string{"Authorization": "Bearer " + token}
+	rec, resp := do(t, h, http.MethodPatch, "/dest", `{"url": "http://sho.rt/dest"}`, auth)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodeRedirectLoop, resp.Error.Code)
+	rec, _ = do(t, h, http.MethodPatch, "/dest", `{"url": "http://sho.rt/hop1"}`, auth)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec, _ = do(t, h, http.MethodGet, "/dest", "", nil)
+	assert.Equal(t, "https://example.com/end", rec.Header().Get("Location"))
+}
+
+// probeResolver resolves every host to the loopback interface, where the httptest servers are
+type probeResolver struct{}
+
+func (probeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if host == "metadata.internal" {
+		return []net.IPAddr{{IP: net.ParseIP("169.254.169.254")}}, nil
+	}
+	return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+}
+
+func TestProbedLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+	origin := "http://public.example:" + strconv.Itoa(port)
+
+	store := memory.New()
+	prober := probe.New(probe.Options{
+		Timeout:  time.Second,
+		Resolver: probeResolver{},
+		Allowed: func(ip net.IP) bool {
+			return ip.IsLoopback() || probe.Public(ip)
+		},
+	})
+	h := bootstrapAPIWithStore(t, store, handlers.WithProber(prober), handlers.WithAdminToken("admin-secret"))
+
+	rec, resp := do(t, h, http.MethodPost, "/", `{"url": "`+origin+`/old", "alias": "probed"}`, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, resp.Data["manage_token"])
+	sd, err := store.Get(context.Background(), "probed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, sd.Probe) {
+		assert.Equal(t, http.StatusOK, sd.Probe.StatusCode)
+		assert.Equal(t, origin+"/new", sd.Probe.FinalURL)
+	}
+
+	rec, resp = do(t, h, http.MethodPost, "/", `{"url": "`+origin+`/missing"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodeUnreachableURL, resp.Error.Code)
+	assert.Contains(t, rec.Body.String(), `"status_code":"404"`)
+
+	rec, resp = do(t, h, http.MethodPost, "/", `{"url": "http://metadata.internal/latest/meta-data/"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodePrivateAddress, resp.Error.Code)
+
+	admin := map[string]string{"Authorization": "Bearer admin-secret"}
+	rec, resp = do(t, h, http.MethodPost, "/api/links/batch", `[
+		{"url": "`+origin+`/new", "alias": "batched"},
+		{"url": "`+origin+`/missing"},
+		{"url": "http://metadata.internal/latest/meta-data/"}
+	]`, admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(1), resp.Data["created"])
+	results, _ := resp.Data["results"].([]any)
+	if assert.Len(t, results, 3) {
+		assert.Nil(t, results[0].(map[string]any)["error"])
+		assert.Equal(t, apiModel.CodeUnreachableURL, results[1].(map[string]any)["error"].(map[string]any)["code"])
+		assert.Equal(t, apiModel.CodePrivateAddress, results[2].(map[string]any)["error"].(map[string]any)["code"])
+	}
+	if sd, err = store.Get(context.Background(), "batched"); assert.NoError(t, err) && assert.NotNil(t, sd.Probe) {
+		assert.Equal(t, http.StatusOK, sd.Probe.StatusCode)
+	}
+
+	// retargeting replaces the outcome of the checks of the previous destination
+	sd, _ = store.Update(context.Background(), "probed", func(data *model.ShortenedData) error {
+		data.Blocked = "host:" + origin
+		return nil
+	})
+	assert.NotEmpty(t, sd.Blocked)
+	rec, resp = do(t, h, http.MethodPatch, "/probed", `{"url": "`+origin+`/missing"}`, admin)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, apiModel.CodeUnreachableURL, resp.Error.Code)
+	rec, _ = do(t, h, http.MethodPatch, "/probed", `{"url": "`+origin+`/new"}`, admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	sd, err = store.Get(context.Background(), "probed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, sd.Blocked)
+	if assert.NotNil(t, sd.Probe) {
+		assert.Equal(t, http.StatusOK, sd.Probe.StatusCode)
+		assert.Equal(t, origin+"/new", sd.Probe.FinalURL)
+	}
+}
+
+func TestBrokenLinks(t *testing.T) {
+	store := memory.New()
+	checked := time.Now().UTC().Truncate(time.Second)
+	for alias, p := range map[string]*model.Probe{
+		"gone":      {StatusCode: http.StatusNotFound, FinalURL: "https://example.com/gone", Checked: checked},
+		"fine":      {StatusCode: http.StatusOK, FinalURL: "https://example.com/fine", Checked: checked},
+		"down":      {Error: "connection refused", Checked: checked},
+		"forbidden": {StatusCode: http.StatusForbidden, FinalURL: "https://example.com/forbidden", Checked: checked},
+		"unchecked": nil,
+	} {
+		sd, err := model.NewAlias("https://example.com/"+alias, alias, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd.Probe = p
+		if err = store.Set(context.Background(), sd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := bootstrapAPIWithStore(t, store, handlers.WithAdminToken("admin-secret"))
+	admin := map[string]string{"Authorization": "Bearer admin-secret"}
+
+	rec, _ := do(t, h, http.MethodGet, "/api/links/broken", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec, _ = do(t, h, http.MethodGet, "/api/links/broken?limit=0", "", admin)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec, resp := do(t, h, http.MethodGet, "/api/links/broken", "", admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	links, _ := resp.Data["links"].([]any)
+	if assert.Len(t, links, 2) {
+		// in the order of the keys
+		down, _ := links[0].(map[string]any)
+		assert.Equal(t, "down", down["short"])
+		probe, _ := down["probe"].(map[string]any)
+		assert.Equal(t, "connection refused", probe["error"])
+		assert.Equal(t, true, probe["broken"])
+		gone, _ := links[1].(map[string]any)
+		assert.Equal(t, "gone", gone["short"])
+		probe, _ = gone["probe"].(map[string]any)
+		assert.Equal(t, float64(http.StatusNotFound), probe["status_code"])
+		assert.Equal(t, checked.Format(time.RFC3339), probe["checked_at"])
+	}
+	assert.Empty(t, resp.Data["next_cursor"])
+
+	// the pages are filled from the following ones of the store
+	var shorts []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		_, resp = do(t, h, http.MethodGet, "/api/links/broken?limit=1&cursor="+cursor, "", admin)
+		links, _ = resp.Data["links"].([]any)
+		for _, l := range links {
+			shorts = append(shorts, stringOf(l.(map[string]any)["short"]))
+		}
+		cursor = stringOf(resp.Data["next_cursor"])
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"down", "gone"}, shorts)
+
+	// every link is listed with the outcome of its last check
+	_, resp = do(t, h, http.MethodGet, "/api/links", "", admin)
+	links, _ = resp.Data["links"].([]any)
+	assert.Len(t, links, 5)
+
+	t.Run("should bound the links scanned by a request", func(t *testing.T) {
+		store := memory.New()
+		for i := 0; i < 30; i++ {
+			sd, err := model.NewAlias("https://example.com/"+strconv.Itoa(i), fmt.Sprintf("fine-%02d", i), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sd.Probe = &model.Probe{StatusCode: http.StatusOK, Checked: checked}
+			if err = store.Set(context.Background(), sd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sd, err := model.NewAlias("https://example.com/gone", "gone", time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sd.Probe = &model.Probe{StatusCode: http.StatusGone, Checked: checked}
+		if err = store.Set(context.Background(), sd); err != nil {
+			t.Fatal(err)
+		}
+		h := bootstrapAPIWithStore(t, store, handlers.WithAdminToken("admin-secret"))
+
+		rec, resp := do(t, h, http.MethodGet, "/api/links/broken?limit=1", "", admin)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, resp.Data["links"])
+		cursor := stringOf(resp.Data["next_cursor"])
+		assert.NotEmpty(t, cursor)
+
+		var shorts []string
+		for i := 0; i < 5 && cursor != ""; i++ {
+			_, resp = do(t, h, http.MethodGet, "/api/links/broken?limit=1&cursor="+cursor, "", admin)
+			links, _ := resp.Data["links"].([]any)
+			for _, l := range links {
+				shorts = append(shorts, stringOf(l.(map[string]any)["short"]))
+			}
+			cursor = stringOf(resp.Data["next_cursor"])
+		}
+		assert.Equal(t, []string{"gone"}, shorts)
+	})
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"expvar"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/render"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+	// maxBrokenLinksPages bounds the pages of the store scanned by a request to BrokenLinks
+	maxBrokenLinksPages = 10
+)
+
+// ListLinks returns a page of the stored short links, it requires the admin token
+// the page is selected with the cursor and limit query parameters
+func (a *API) ListLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	if err := a.authorizeAdmin(r); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	limit, err := listLimit(r)
+	if err != nil {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidQuery, err)
+		return
+	}
+
+	links, next, err := a.p.List(r.Context(), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		log.Errorf("ListLinks() List: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	resp := apiModel.ListLinksResponse{Links: make([]apiModel.LinkSummary, len(links)), NextCursor: next}
+	for i, l := range links {
+		resp.Links[i] = a.linkSummary(l)
+	}
+
+	_, _ = render.Render(render.Response[any]{StatusCode: http.StatusOK, Data: resp}, w)
+}
+
+// DebugVars serves the variables published with expvar, it requires the admin token
+func (a *API) DebugVars(w http.ResponseWriter, r *http.Request) {
+	if err := a.authorizeAdmin(r); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
+
+// BrokenLinks returns a page of the stored short links whose destination was found broken by its last check, see model.Probe
+// it requires the admin token, the page is selected like for ListLinks but may hold more than limit links
+func (a *API) BrokenLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	if err := a.authorizeAdmin(r); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	limit, err := listLimit(r)
+	if err != nil {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidQuery, err)
+		return
+	}
+
+	// the pages of the store are filtered until there are enough broken links, the last one is kept whole
+	// so that the cursor of the store can be handed out, a page may come short of limit if they are scarce
+	resp := apiModel.ListLinksResponse{Links: []apiModel.LinkSummary{}}
+	cursor := r.URL.Query().Get("cursor")
+	for pages := 1; ; pages++ {
+		links, next, err := a.p.List(r.Context(), cursor, limit)
+		if err != nil {
+			log.Errorf("BrokenLinks() List: %v", err)
+			handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+			return
+		}
+		for _, l := range links {
+			if l.Probe != nil && l.Probe.Broken() {
+				resp.Links = append(resp.Links, a.linkSummary(l))
+			}
+		}
+		resp.NextCursor = next
+		if len(resp.Links) >= limit || next == "" || pages == maxBrokenLinksPages {
+			break
+		}
+		cursor = next
+	}
+
+	_, _ = render.Render(render.Response[any]{StatusCode: http.StatusOK, Data: resp}, w)
+}
+
+// listLimit returns the page size asked for with the limit query parameter
+func listLimit(r *http.Request) (int, error) {
+	l := r.URL.Query().Get("limit")
+	if l == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(l)
+	if err != nil || limit <= 0 || limit > maxListLimit {
+		return 0, errors.New("limit has to be between 1 and 1000")
+	}
+	return limit, nil
+}
+
+// linkSummary describes l to the admin
+func (a *API) linkSummary(l *model.ShortenedData) apiModel.LinkSummary {
+	s := apiModel.LinkSummary{
+		Short:        l.Short,
+		ShortLinkURL: a.hostDomain + "/" + l.Key,
+		OriginalURL:  l.Orig,
+		ExpiresAt:    expiresAt(l),
+		NotBefore:    notBefore(l),
+		PrelaunchURL: l.Prelaunch,
+		FallbackURL:  l.Fallback,
+		Protected:    l.Protected(),
+		MaxUses:      l.MaxUses,
+		Uses:         l.Uses,
+		Custom:       l.Custom,
+		Blocked:      l.Blocked,
+	}
+	if l.Probe != nil {
+		s.Probe = &apiModel.LinkProbe{
+			StatusCode: l.Probe.StatusCode,
+			FinalURL:   l.Probe.FinalURL,
+			Error:      l.Probe.Error,
+			Broken:     l.Probe.Broken(),
+			CheckedAt:  l.Probe.Checked,
+		}
+	}
+	return s
+}
+
+// LinkStats returns the click statistics of a short link, it requires the manage token of the link or the admin token
+func (a *API) LinkStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	if a.analytics == nil {
+		handleErr(w, r, http.StatusNotFound, apiModel.CodeDisabled, errors.New("analytics are disabled"))
+		return
+	}
+
+	key := chi.URLParam(r, "id")
+	sd, err := a.p.Get(r.Context(), key)
+	if err != nil {
+		handleErr(w, r, http.StatusNotFound, apiModel.CodeNotFound, errors.New("invalid link provider"))
+		return
+	}
+
+	if err = a.authorize(r, sd); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	stats, err := a.analytics.Stats(r.Context(), key)
+	if err != nil {
+		log.Errorf("LinkStats() Stats: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	resp := apiModel.LinkStatsResponse{
+		Short:  sd.Short,
+		Total:  stats.Total,
+		Hourly: toStatsPoints(stats.Hourly),
+		Daily:  toStatsPoints(stats.Daily),
+	}
+	_, _ = render.Render(render.Response[any]{StatusCode: http.StatusOK, Data: resp}, w)
+}
+
+// LinkInfo describes where a short link goes without following it, as a preview page to browsers and as JSON otherwise
+// the destination of protected or disabled links and of links which don't redirect yet is not disclosed
+func (a *API) LinkInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	key := chi.URLParam(r, "id")
+	short := a.hostDomain + "/" + key
+	sd, err := a.p.Get(r.Context(), key)
+	switch {
+	case err == nil:
+	case errors.Is(err, persist.ErrExpired):
+		a.renderPage(w, r, http.StatusGone, "expired.html", page{
+			Title:   "This link has expired",
+			Message: "The short link has expired and no longer points anywhere.",
+			Short:   short,
+		}, apiModel.CodeExpired, errors.New("link has expired"))
+		return
+	case errors.Is(err, persist.ErrNotFound):
+		a.renderPage(w, r, http.StatusNotFound, "expired.html", page{
+			Title:   "This link doesn't exist",
+			Message: "The short link may have expired or been removed.",
+			Short:   short,
+		}, apiModel.CodeNotFound, errors.New("invalid link provider"))
+		return
+	default:
+		log.Errorf("LinkInfo() Get: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	info := apiModel.LinkInfoResponse{
+		Short:        sd.Short,
+		ShortLinkURL: short,
+		ExpiresAt:    expiresAt(sd),
+		NotBefore:    notBefore(sd),
+		Protected:    sd.Protected(),
+		Blocked:      sd.Blocked != "",
+		MaxUses:      sd.MaxUses,
+		Uses:         sd.Uses,
+	}
+	if !info.Protected && !info.Blocked && info.NotBefore == nil {
+		info.OriginalURL = sd.Orig
+	}
+	if !sd.Created.IsZero() {
+		info.CreatedAt = &sd.Created
+	}
+	if a.analytics != nil {
+		// the preview is still useful without the clicks
+		stats, err := a.analytics.Stats(r.Context(), key)
+		if err != nil {
+			log.Errorf("LinkInfo() Stats: %v", err)
+		} else {
+			info.Clicks = &stats.Total
+		}
+	}
+
+	w.Header().Set("Vary", "Accept")
+	if render.Accepts(r, "text/html") {
+		_, err = render.HTML(w, http.StatusOK, a.pages, "preview.html", page{
+			Title: "Where does this link go?",
+			Short: short,
+			Link:  &info,
+		})
+		if err == nil {
+			return
+		}
+		log.Errorf("LinkInfo() preview.html: %v", err)
+	}
+	_, _ = render.Render(render.Response[any]{StatusCode: http.StatusOK, Data: info}, w)
+}
+
+func toStatsPoints(counts []model.ClickCount) []apiModel.StatsPoint {
+	points := make([]apiModel.StatsPoint, len(counts))
+	for i, c := range counts {
+		points[i] = apiModel.StatsPoint{Start: c.Start, Count: c.Count}
+	}
+	return points
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/render"
+)
+
+var (
+	errUnauthorized = errors.New("missing bearer token")
+	errForbidden    = errors.New("invalid token")
+	errShared       = errors.New("the destination of a link handed out to others can only be changed by the admin")
+)
+
+// DeleteShortLink removes a short link, the manage token handed out on creation
+// has to be passed as a bearer token
+func (a *API) DeleteShortLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	key := chi.URLParam(r, "id")
+	// an expired link kept for its fallback can still be deleted by its owner
+	sd, err := a.p.Get(r.Context(), key)
+	switch {
+	case err == nil, errors.Is(err, persist.ErrExpired):
+	case errors.Is(err, persist.ErrNotFound):
+		handleErr(w, r, http.StatusNotFound, apiModel.CodeNotFound, errors.New("invalid link provider"))
+		return
+	default:
+		log.Errorf("DeleteShortLink() Get: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	if err = a.authorize(r, sd); err != nil {
+		handleAuthErr(w, r, err)
+		return
+	}
+
+	if err = a.p.Delete(r.Context(), key); err != nil {
+		if errors.Is(err, persist.ErrNotFound) {
+			handleErr(w, r, http.StatusNotFound, apiModel.CodeNotFound, errors.New("invalid link provider"))
+			return
+		}
+		log.Errorf("DeleteShortLink() Delete: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateShortLink changes the destination and/or the expiry of a short link, the manage token
+// handed out on creation has to be passed as a bearer token
+func (a *API) UpdateShortLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidMethod, errors.New("invalid request method"))
+		return
+	}
+
+	defer r.Body.Close()
+
+	var body apiModel.UpdateShortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidBody, err)
+		return
+	}
+
+	// the new destination is probed before the update, the store holds the record while it runs
+	var probed *model.Probe
+	if body.OriginalURL != nil {
+		orig, status, rerr := a.checkURL(r.Context(), "url", *body.OriginalURL, chi.URLParam(r, "id"))
+		if rerr != nil {
+			_, _ = render.RenderError(w, r, status, rerr)
+			return
+		}
+		body.OriginalURL = &orig
+		if a.prober != nil {
+			target := &model.ShortenedData{Orig: orig}
+			if status, rerr = a.probe(r.Context(), target); rerr != nil {
+				_, _ = render.RenderError(w, r, status, rerr)
+				return
+			}
+			probed = target.Probe
+		}
+	}
+
+	if body.Fallback != nil && *body.Fallback != "" {
+		fallback, status, rerr := a.checkURL(r.Context(), "fallback_url", *body.Fallback, chi.URLParam(r, "id"))
+		if rerr != nil {
+			_, _ = render.RenderError(w, r, status, rerr)
+			return
+		}
+		body.Fallback = &fallback
+	}
+
+	if err := a.checkUpdateExpiry(body); err != nil {
+		handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidExpiry, err)
+		return
+	}
+
+	// hashed before the update, bcrypt is too slow to run while the store holds the record
+	var passwordHash string
+	if body.Password != nil {
+		var err error
+		if passwordHash, err = model.HashPassword(*body.Password); err != nil {
+			handleErr(w, r, http.StatusBadRequest, apiModel.CodeInvalidPassword, err)
+			return
+		}
+	}
+
+	key := chi.URLParam(r, "id")
+	sd, err := a.p.Update(r.Context(), key, func(data *model.ShortenedData) error {
+		if err := a.authorize(r, data); err != nil {
+			return err
+		}
+		if data.Shared && (body.OriginalURL != nil || body.Fallback != nil) && !a.isAdmin(bearerToken(r)) {
+			return errShared
+		}
+		if body.OriginalURL != nil {
+			data.Orig = *body.OriginalURL
+			data.Rehash()
+		}
+		if body.ExpiresAt != nil {
+			data.Expiry = body.ExpiresAt.UTC()
+		}
+		if body.NeverExpire {
+			data.Expiry = time.Time{}
+		}
+		if body.Fallback != nil {
+			data.Fallback = *body.Fallback
+			data.Rehash()
+		}
+		if body.Password != nil {
+			data.SetPasswordHash(passwordHash)
+		}
+		if body.OriginalURL != nil {
+			// the checks of the previous destination don't hold for the new one
+			data.Probe = probed
+			data.Blocked = ""
+			if a.screener != nil {
+				if m, ok := a.screener.CheckLink(data); ok {
+					data.Blocked = m.String()
+				}
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, persist.ErrNotFound):
+		handleErr(w, r, http.StatusNotFound, apiModel.CodeNotFound, errors.New("invalid link provider"))
+		return
+	case errors.Is(err, errUnauthorized), errors.Is(err, errForbidden):
+		handleAuthErr(w, r, err)
+		return
+	case errors.Is(err, errShared):
+		handleErr(w, r, http.StatusConflict, apiModel.CodeSharedLink, err)
+		return
+	default:
+		log.Errorf("UpdateShortLink() Update: %v", err)
+		handleErr(w, r, http.StatusInternalServerError, apiModel.CodeInternal, errors.New("internal error"))
+		return
+	}
+
+	_, _ = render.Render(
+		render.Response[any]{
+			StatusCode: http.StatusOK,
+			Data: apiModel.UpdateShortLinkResponse{
+				ShortLinkURL: a.hostDomain + "/" + sd.Short,
+				OriginalURL:  sd.Orig,
+				ExpiresAt:    expiresAt(sd),
+			},
+		}, w,
+	)
+}
+
+// checkUpdateExpiry checks the expiry requested in body against the configured bounds
+func (a *API) checkUpdateExpiry(body apiModel.UpdateShortLinkRequest) error {
+	switch {
+	case body.ExpiresAt != nil && body.NeverExpire:
+		return errors.New("only one of expires_at and never_expire can be set")
+	case body.NeverExpire:
+		return a.checkExpiry(0)
+	case body.ExpiresAt != nil:
+		ttl := time.Until(*body.ExpiresAt)
+		if ttl <= 0 {
+			return errors.New("expiry has to be in the future")
+		}
+		return a.checkExpiry(ttl)
+	default:
+		return nil
+	}
+}
+
+// authorize checks the bearer token of r against the owner of sd, or the admin token
+func (a *API) authorize(r *http.Request, sd *model.ShortenedData) error {
+	token := bearerToken(r)
+	if token == "" {
+		return errUnauthorized
+	}
+	if !sd.IsOwner(token) && !a.isAdmin(token) {
+		return errForbidden
+	}
+	return nil
+}
+
+// authorizeAdmin checks the bearer token of r against the admin token
+func (a *API) authorizeAdmin(r *http.Request) error {
+	token := bearerToken(r)
+	if token == "" {
+		return errUnauthorized
+	}
+	if !a.isAdmin(token) {
+		return errForbidden
+	}
+	return nil
+}
+
+func (a *API) isAdmin(token string) bool {
+	return a.adminToken != "" && subtle.ConstantTimeCompare([]byte(a.adminToken), []byte(token)) == 1
+}
+
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+func handleAuthErr(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errUnauthorized) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		handleErr(w, r, http.StatusUnauthorized, apiModel.CodeUnauthorized, err)
+		return
+	}
+	handleErr(w, r, http.StatusForbidden, apiModel.CodeForbidden, err)
+}
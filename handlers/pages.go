@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/render"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+// defaultPages are the HTML pages served to browsers, see LoadPages to override them
+var defaultPages = template.Must(template.ParseFS(templatesFS, "templates/*.html"))
+
+// page is the data every page template is executed with
+// NotBefore is only set for scheduled links, Link for the preview page
+type page struct {
+	Title     string
+	Message   string
+	Short     string
+	Error     string
+	NotBefore time.Time
+	Link      *apiModel.LinkInfoResponse
+}
+
+// LoadPages returns the default pages, overridden by the templates of dir having the same file name
+// e.g. dir/expired.html replaces the page served for expired links
+func LoadPages(dir string) (*template.Template, error) {
+	// parsed again rather than cloned, html/template can't clone a template which has been executed
+	t, err := template.ParseFS(templatesFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil || len(matches) == 0 {
+		return t, err
+	}
+	return t.ParseFiles(matches...)
+}
+
+// WithPages sets the HTML pages served to browsers, see LoadPages
+func WithPages(t *template.Template) Option {
+	return func(a *API) {
+		a.pages = t
+	}
+}
+
+// renderPage answers with the page name to clients accepting HTML, and with err in the error envelope otherwise
+func (a *API) renderPage(w http.ResponseWriter, r *http.Request, statusCode int, name string, data page, code string, err error) {
+	if render.Accepts(r, "text/html") {
+		_, rerr := render.HTML(w, statusCode, a.pages, name, data)
+		if rerr == nil {
+			return
+		}
+		log.Errorf("renderPage() %s: %v", name, rerr)
+	}
+	handleErr(w, r, statusCode, code, err)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/didip/tollbooth/v6"
+	"github.com/didip/tollbooth/v6/limiter"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/model"
+)
+
+const (
+	// PasswordHeader carries the password of a protected link for API clients
+	PasswordHeader = "X-Link-Password"
+
+	defaultPasswordAttempts = 5
+	defaultPasswordPeriod   = time.Minute
+	// linkAttemptsFactor is how many clients can use up their attempts on a link before it is locked for everyone,
+	// so that rotating the source address doesn't get more attempts
+	linkAttemptsFactor  = 10
+	maxPasswordFormSize = 4 << 10
+)
+
+// WithPasswordAttempts allows n password attempts per period on a protected link from the same client, and 10 times as
+// many from all the clients together, defaults to 5 per minute
+func WithPasswordAttempts(n int, period time.Duration) Option {
+	return func(a *API) {
+		a.passwordLimiter, a.linkLimiter = newPasswordLimiters(n, period)
+	}
+}
+
+// newPasswordLimiters returns the limiter of the attempts of a client on a link, and the one of all the attempts on a link
+func newPasswordLimiters(n int, period time.Duration) (*limiter.Limiter, *limiter.Limiter) {
+	if n <= 0 || period <= 0 {
+		n, period = defaultPasswordAttempts, defaultPasswordPeriod
+	}
+	newLimiter := func(n int) *limiter.Limiter {
+		return tollbooth.NewLimiter(float64(n)/period.Seconds(), &limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour}).
+			SetBurst(n)
+	}
+	return newLimiter(n), newLimiter(linkAttemptsFactor * n)
+}
+
+// unlock checks the password of a protected link, given in the X-Link-Password header or in the form served to browsers
+// the request is answered and false is returned if the link can't be followed
+func (a *API) unlock(w http.ResponseWriter, r *http.Request, sd *model.ShortenedData) bool {
+	password := r.Header.Get(PasswordHeader)
+	if password == "" && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormSize)
+		password = r.PostFormValue("password")
+	}
+
+	data := page{
+		Title:   "This link is password protected",
+		Message: "Enter the password you were given to continue.",
+		Short:   a.hostDomain + "/" + sd.Key,
+	}
+	if password == "" {
+		a.renderPage(w, r, http.StatusUnauthorized, "password.html", data,
+			apiModel.CodePasswordRequired, errors.New("password required"))
+		return false
+	}
+
+	// every attempt counts, so that the passwords can't be brute forced, a client only uses up the attempts of the link
+	// while it has some left itself
+	lim := a.passwordLimiter
+	httpErr := tollbooth.LimitByKeys(lim, []string{sd.Key, a.clientIP(r)})
+	if httpErr == nil {
+		lim = a.linkLimiter
+		httpErr = tollbooth.LimitByKeys(lim, []string{sd.Key})
+	}
+	if httpErr != nil {
+		// the time it takes to get another attempt back
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(1/lim.GetMax()))))
+		data.Error = "Too many attempts, please try again later."
+		a.renderPage(w, r, http.StatusTooManyRequests, "password.html", data,
+			apiModel.CodeTooManyAttempts, errors.New("too many password attempts"))
+		return false
+	}
+
+	if !sd.CheckPassword(password) {
+		data.Error = "Wrong password."
+		a.renderPage(w, r, http.StatusForbidden, "password.html", data,
+			apiModel.CodeInvalidPassword, errors.New("invalid password"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/probe"
+	"github.com/alexadhy/shortener/render"
+)
+
+// WithProber checks that the destination of a link responds before creating it, see probe.Prober
+func WithProber(p *probe.Prober) Option {
+	return func(a *API) {
+		a.prober = p
+	}
+}
+
+// probe checks the destination of sd and records the outcome on it
+// the status code and the error to answer with are returned if the destination is refused or broken
+func (a *API) probe(ctx context.Context, sd *model.ShortenedData) (int, *render.Error) {
+	res, err := a.prober.Probe(ctx, sd.Orig)
+	sd.Probe = &res
+	if errors.Is(err, probe.ErrForbiddenAddress) {
+		return http.StatusBadRequest, render.NewError(apiModel.CodePrivateAddress, err).
+			WithDetails(map[string]string{"field": "url"})
+	}
+	if res.Broken() {
+		details := map[string]string{"field": "url"}
+		if res.StatusCode != 0 {
+			details["status_code"] = strconv.Itoa(res.StatusCode)
+			details["final_url"] = res.FinalURL
+		} else {
+			details["reason"] = res.Error
+		}
+		return http.StatusBadRequest, render.NewError(apiModel.CodeUnreachableURL, errors.New("destination doesn't respond")).
+			WithDetails(details)
+	}
+	return 0, nil
+}
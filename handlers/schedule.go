@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/model"
+)
+
+// WithPrelaunchURL sets where scheduled links without their own pre-launch URL redirect to before they start
+// the "not yet available" page is served if it is empty
+func WithPrelaunchURL(u string) Option {
+	return func(a *API) {
+		a.prelaunchURL = u
+	}
+}
+
+// schedule sets the activation window requested in body on sd, once its expiry is known
+// links starting in the past are active right away
+func schedule(sd *model.ShortenedData, body apiModel.CreateShortLinkRequest) error {
+	if body.NotBefore == nil {
+		if body.Prelaunch != "" {
+			return errors.New("prelaunch_url requires not_before")
+		}
+		return nil
+	}
+
+	nb := body.NotBefore.UTC()
+	if !sd.Expiry.IsZero() && !nb.Before(sd.Expiry) {
+		return errors.New("not_before has to be before the expiry")
+	}
+	if nb.After(time.Now()) {
+		sd.NotBefore = nb
+		sd.Prelaunch = body.Prelaunch
+	}
+	return nil
+}
+
+// notYetActive answers requests to a link before its activation window opens
+// with a redirect to the pre-launch URL if there is one, the "not yet available" page otherwise
+func (a *API) notYetActive(w http.ResponseWriter, r *http.Request, sd *model.ShortenedData) {
+	w.Header().Set("Cache-Control", "no-store")
+	if wait := time.Until(sd.NotBefore); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	}
+
+	prelaunch := sd.Prelaunch
+	if prelaunch == "" {
+		prelaunch = a.prelaunchURL
+	}
+	if prelaunch != "" {
+		http.Redirect(w, r, prelaunch, http.StatusFound)
+		return
+	}
+
+	nb := sd.NotBefore.UTC()
+	a.renderPage(w, r, http.StatusNotFound, "scheduled.html", page{
+		Title:     "This link isn't available yet",
+		Message:   "The short link you followed will be available from " + nb.Format("Mon, 02 Jan 2006 15:04 MST") + ".",
+		Short:     a.hostDomain + "/" + sd.Key,
+		NotBefore: nb,
+	}, apiModel.CodeNotYetActive, fmt.Errorf("link is available from %s", nb.Format(time.RFC3339)))
+}
+
+// notBefore returns when sd starts redirecting, nil if it already does
+func notBefore(sd *model.ShortenedData) *time.Time {
+	if sd.ActiveAt(time.Now()) {
+		return nil
+	}
+	nb := sd.NotBefore.UTC()
+	return &nb
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/render"
+	"github.com/alexadhy/shortener/urlnorm"
+)
+
+// maxSelfLinkHops is how many of our own short links are followed to resolve a destination
+const maxSelfLinkHops = 5
+
+// WithAliasDomains sets the other domains serving the same short links as hostDomain, e.g. sho.rt or https://www.sho.rt
+// destinations on them are handled like the ones on hostDomain, see resolveSelfLink
+func WithAliasDomains(domains ...string) Option {
+	return func(a *API) {
+		a.aliasDomains = domains
+	}
+}
+
+// ownHosts returns the hosts, with their non default port, of hostDomain and of the alias domains
+func ownHosts(hostDomain string, aliases []string) map[string]bool {
+	// default ports are removed the same way as in the destinations
+	norm := urlnorm.New(urlnorm.Options{})
+	hosts := make(map[string]bool, len(aliases)+1)
+	for _, d := range append([]string{hostDomain}, aliases...) {
+		if !strings.Contains(d, "://") {
+			d = "http://" + d
+		}
+		canonical, err := norm.Normalize(d)
+		if err != nil {
+			log.Errorf("ignoring invalid short domain %q: %v", d, err)
+			continue
+		}
+		if u, err := url.Parse(canonical); err == nil {
+			hosts[u.Host] = true
+		}
+	}
+	return hosts
+}
+
+// resolveSelfLink returns the destination of the short link of this server u points to, following the ones it points to in turn
+// key is the link being retargeted, if any, so that it can't end up pointing to itself
+// links which can't be copied, i.e. protected, limited, scheduled or disabled ones, are refused along with the unknown ones
+func (a *API) resolveSelfLink(ctx context.Context, field string, u *url.URL, key string) (string, int, *render.Error) {
+	seen := map[string]bool{}
+	if key != "" {
+		seen[key] = true
+	}
+	for hop := 0; hop < maxSelfLinkHops; hop++ {
+		k := strings.TrimPrefix(u.Path, "/")
+		if k == "" || strings.ContainsAny(k, "/+") {
+			return "", http.StatusBadRequest, selfLinkError(apiModel.CodeSelfLink, field, errors.New("destination is on this server but isn't a short link"))
+		}
+		if seen[k] {
+			return "", http.StatusBadRequest, selfLinkError(apiModel.CodeRedirectLoop, field, errors.New("destination leads back to "+k))
+		}
+		seen[k] = true
+
+		sd, err := a.p.Get(ctx, k)
+		switch {
+		case err == nil:
+		case errors.Is(err, persist.ErrNotFound), errors.Is(err, persist.ErrExpired):
+			return "", http.StatusBadRequest, selfLinkError(apiModel.CodeSelfLink, field, errors.New("destination is an unknown short link"))
+		default:
+			log.Errorf("resolveSelfLink() Get: %v", err)
+			return "", http.StatusInternalServerError, internalError()
+		}
+		if sd.Protected() || sd.Limited() || !sd.ActiveAt(time.Now()) || sd.Blocked != "" {
+			return "", http.StatusBadRequest, selfLinkError(apiModel.CodeSelfLink, field, errors.New("destination is a short link which can't be resolved"))
+		}
+
+		next, err := url.Parse(sd.Orig)
+		if err != nil {
+			log.Errorf("resolveSelfLink() Parse: %v", err)
+			return "", http.StatusInternalServerError, internalError()
+		}
+		if !a.ownHosts[next.Host] {
+			return sd.Orig, 0, nil
+		}
+		// stored before the domain was known as ours, or pointing to another alias domain
+		u = next
+	}
+	return "", http.StatusBadRequest, selfLinkError(apiModel.CodeRedirectLoop, field, errors.New("destination goes through too many short links"))
+}
+
+func selfLinkError(code, field string, err error) *render.Error {
+	return render.NewError(code, err).WithDetails(map[string]string{"field": field})
+}
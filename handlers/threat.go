@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alexadhy/shortener/apiModel"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/threat"
+)
+
+// WithScreener rejects the destinations listed by s, see threat.Screener
+// if checkRedirects is true the destination of a link is also checked whenever it is followed,
+// so that a link listed since it was created is disabled before the next scan
+func WithScreener(s *threat.Screener, checkRedirects bool) Option {
+	return func(a *API) {
+		a.screener = s
+		a.checkRedirects = checkRedirects
+	}
+}
+
+// screen disables sd if its destination got listed since it was created, it returns whether sd is blocked
+func (a *API) screen(r *http.Request, sd *model.ShortenedData) bool {
+	if sd.Blocked != "" {
+		return true
+	}
+	if a.screener == nil || !a.checkRedirects {
+		return false
+	}
+	m, ok := a.screener.CheckLink(sd)
+	if !ok {
+		return false
+	}
+	if err := threat.Block(r.Context(), a.p, sd.Key, m); err != nil {
+		// it is still refused, the next scan will persist it
+		log.Errorf("HandleRedirect() Block: %v", err)
+	}
+	sd.Blocked = m.String()
+	return true
+}
+
+// blocked answers the request to a link which was disabled, its destination is not disclosed
+func (a *API) blocked(w http.ResponseWriter, r *http.Request, sd *model.ShortenedData) {
+	w.Header().Set("Cache-Control", "no-store")
+	a.renderPage(w, r, http.StatusGone, "blocked.html", page{
+		Title:   "This link has been disabled",
+		Message: "The short link you followed pointed to a site reported as unsafe, it no longer redirects.",
+		Short:   a.hostDomain + "/" + sd.Key,
+	}, apiModel.CodeBlocked, errors.New("link has been disabled"))
+}
@@ -0,0 +1,235 @@
+// Package healthcheck periodically probes the destinations of the stored links and records the outcome on them
+// so that the broken ones can be listed, see model.Probe
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/probe"
+)
+
+const (
+	defaultInterval    = 24 * time.Hour
+	defaultConcurrency = 8
+	defaultHostDelay   = time.Second
+	pageSize           = 500
+)
+
+var (
+	// checkedLinks is the number of destinations probed since the start, brokenLinks the number found broken
+	// by the last round, both exported on /debug/vars
+	checkedLinks = expvar.NewInt("health_checked_links")
+	brokenLinks  = expvar.NewInt("broken_links")
+
+	// errRetargeted is returned to abort recording the outcome for a destination which changed while it was probed
+	errRetargeted = errors.New("link was retargeted")
+)
+
+// Options configures a Checker, the zero values are defaulted
+type Options struct {
+	// Interval is how often a round starts, the links probed less than half of it ago are skipped,
+	// e.g. on creation or by the round before a restart
+	Interval time.Duration
+	// Concurrency is how many destinations are probed at once
+	Concurrency int
+	// HostDelay is the minimum delay between two requests to the same host
+	HostDelay time.Duration
+}
+
+// Report sums up a round
+type Report struct {
+	Checked int
+	Broken  int
+}
+
+// Checker runs a round on a fixed interval until it is closed
+type Checker struct {
+	p      persist.Persist
+	prober *probe.Prober
+	opts   Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a checker and starts its worker, Close has to be called to stop it
+// the first round starts right away
+func New(p persist.Persist, prober *probe.Prober, opts Options) *Checker {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.HostDelay <= 0 {
+		opts.HostDelay = defaultHostDelay
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Checker{p: p, prober: prober, opts: opts, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	go c.run()
+	return c
+}
+
+// Check probes the destinations of the stored links which weren't recently, and records the outcome on them
+// the links which can't be followed anyway, i.e. disabled ones, and the non HTTP destinations are skipped
+func (c *Checker) Check(ctx context.Context) (Report, error) {
+	var mu sync.Mutex
+	var report Report
+	hosts := newPoliteness(c.opts.HostDelay)
+
+	links := make(chan *model.ShortenedData)
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for sd := range links {
+				res, ok := c.check(ctx, hosts, sd)
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				report.Checked++
+				if res.Broken() {
+					report.Broken++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := c.walk(ctx, links)
+	close(links)
+	wg.Wait()
+	if err == nil {
+		brokenLinks.Set(int64(report.Broken))
+	}
+	return report, err
+}
+
+// Close stops the worker, the running round if any is cancelled
+func (c *Checker) Close() {
+	c.cancel()
+	<-c.done
+}
+
+// walk sends the links due for a check to links, until the store is exhausted or ctx is done
+func (c *Checker) walk(ctx context.Context, links chan<- *model.ShortenedData) error {
+	cursor := ""
+	for {
+		page, next, err := c.p.List(ctx, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, sd := range page {
+			if !c.due(sd, now) {
+				continue
+			}
+			select {
+			case links <- sd:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// due reports whether the destination of sd has to be probed
+func (c *Checker) due(sd *model.ShortenedData, now time.Time) bool {
+	if sd.Blocked != "" {
+		return false
+	}
+	if sd.Probe != nil && now.Sub(sd.Probe.Checked) < c.opts.Interval/2 {
+		return false
+	}
+	u, err := url.Parse(sd.Orig)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// check probes the destination of sd once its host can be requested, and records the outcome
+// false is returned if it couldn't be probed or recorded
+func (c *Checker) check(ctx context.Context, hosts *politeness, sd *model.ShortenedData) (model.Probe, bool) {
+	u, err := url.Parse(sd.Orig)
+	if err != nil {
+		return model.Probe{}, false
+	}
+	if err = hosts.wait(ctx, u.Hostname()); err != nil {
+		return model.Probe{}, false
+	}
+
+	// the failures are part of the outcome
+	res, _ := c.prober.Probe(ctx, sd.Orig)
+	if ctx.Err() != nil {
+		return model.Probe{}, false
+	}
+	checkedLinks.Add(1)
+
+	_, err = c.p.Update(ctx, sd.Key, func(data *model.ShortenedData) error {
+		if data.Orig != sd.Orig {
+			return errRetargeted
+		}
+		data.Probe = &res
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errRetargeted), errors.Is(err, persist.ErrNotFound):
+		// changed or removed since it was listed, the outcome is stale
+		return model.Probe{}, false
+	default:
+		if ctx.Err() == nil {
+			log.Errorf("healthcheck Update: %v", err)
+		}
+		return model.Probe{}, false
+	}
+	if res.Broken() {
+		log.Infof("link %s is broken: %s", sd.Key, describe(res))
+	}
+	return res, true
+}
+
+func (c *Checker) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := c.Check(c.ctx)
+		if err != nil && c.ctx.Err() == nil {
+			log.Errorf("healthcheck: %v", err)
+		}
+		if report.Checked > 0 {
+			log.Infof("healthcheck probed %d links, %d broken", report.Checked, report.Broken)
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func describe(res model.Probe) string {
+	if res.Error != "" {
+		return res.Error
+	}
+	return res.FinalURL + " answered " + http.StatusText(res.StatusCode)
+}
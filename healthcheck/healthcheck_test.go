@@ -0,0 +1,199 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist/memory"
+	"github.com/alexadhy/shortener/probe"
+)
+
+// loopbackResolver resolves every host to the loopback interface, where the httptest servers are
+type loopbackResolver struct{}
+
+func (loopbackResolver) LookupIPAddr(_ context.Context, _ string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+}
+
+func newProber() *probe.Prober {
+	return probe.New(probe.Options{
+		Timeout:  time.Second,
+		Resolver: loopbackResolver{},
+		Allowed:  func(ip net.IP) bool { return ip.IsLoopback() },
+	})
+}
+
+// server answers 404 on /missing and 200 otherwise, it records when each host was requested
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	inFlight int32
+	maxIn    int32
+}
+
+func newServer(t *testing.T) *server {
+	s := &server{requests: map[string][]time.Time{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&s.inFlight, 1)
+		defer atomic.AddInt32(&s.inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&s.maxIn)
+			if n <= max || atomic.CompareAndSwapInt32(&s.maxIn, max, n) {
+				break
+			}
+		}
+
+		s.mu.Lock()
+		host, _, _ := net.SplitHostPort(r.Host)
+		s.requests[host] = append(s.requests[host], time.Now())
+		s.mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) port() string {
+	return strconv.Itoa(s.Listener.Addr().(*net.TCPAddr).Port)
+}
+
+func store(t *testing.T, p *memory.Store, alias, orig string, edit func(sd *model.ShortenedData)) {
+	t.Helper()
+	sd, err := model.NewAlias(orig, alias, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		edit(sd)
+	}
+	if err = p.Set(context.Background(), sd); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	srv := newServer(t)
+	origin := func(host string) string {
+		return "http://" + host + ":" + srv.port()
+	}
+
+	p := memory.New()
+	store(t, p, "fine", origin("a.example")+"/ok", nil)
+	store(t, p, "missing", origin("a.example")+"/missing", nil)
+	store(t, p, "other", origin("b.example")+"/ok", nil)
+	store(t, p, "ftp", "ftp://a.example/file", nil)
+	store(t, p, "blocked", origin("c.example")+"/ok", func(sd *model.ShortenedData) {
+		sd.Blocked = "host: c.example"
+	})
+	store(t, p, "recent", origin("c.example")+"/missing", func(sd *model.ShortenedData) {
+		sd.Probe = &model.Probe{StatusCode: http.StatusOK, Checked: time.Now().UTC().Add(-time.Minute)}
+	})
+	store(t, p, "stale", origin("c.example")+"/missing", func(sd *model.ShortenedData) {
+		sd.Probe = &model.Probe{StatusCode: http.StatusOK, Checked: time.Now().UTC().Add(-time.Hour)}
+	})
+
+	c := &Checker{p: p, prober: newProber(), opts: Options{Interval: time.Hour, Concurrency: 4, HostDelay: 50 * time.Millisecond}}
+	report, err := c.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, Report{Checked: 4, Broken: 2}, report)
+	assert.Equal(t, int64(2), brokenLinks.Value())
+
+	tests := []struct {
+		key    string
+		status int
+		broken bool
+	}{
+		{key: "fine", status: http.StatusOK},
+		{key: "missing", status: http.StatusNotFound, broken: true},
+		{key: "other", status: http.StatusOK},
+		{key: "stale", status: http.StatusNotFound, broken: true},
+		{key: "recent", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			sd, err := p.Get(context.Background(), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if assert.NotNil(t, sd.Probe) {
+				assert.Equal(t, tt.status, sd.Probe.StatusCode)
+				assert.Equal(t, tt.broken, sd.Probe.Broken())
+			}
+		})
+	}
+	for _, key := range []string{"ftp", "blocked"} {
+		sd, err := p.Get(context.Background(), key)
+		assert.Nil(t, err)
+		assert.Nil(t, sd.Probe, key)
+	}
+
+	// the requests to a host are spaced out, while the other hosts are requested meanwhile
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Len(t, srv.requests["a.example"], 2)
+	times := srv.requests["a.example"]
+	assert.GreaterOrEqual(t, times[1].Sub(times[0]), 45*time.Millisecond)
+	assert.Len(t, srv.requests["b.example"], 1)
+	assert.LessOrEqual(t, atomic.LoadInt32(&srv.maxIn), int32(4))
+}
+
+func TestCheckConcurrency(t *testing.T) {
+	srv := newServer(t)
+	p := memory.New()
+	for i := 0; i < 12; i++ {
+		host := "host" + strconv.Itoa(i) + ".example"
+		store(t, p, "link"+strconv.Itoa(i), "http://"+host+":"+srv.port()+"/", nil)
+	}
+
+	c := &Checker{p: p, prober: newProber(), opts: Options{Interval: time.Hour, Concurrency: 3, HostDelay: time.Second}}
+	report, err := c.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 12, report.Checked)
+	assert.LessOrEqual(t, atomic.LoadInt32(&srv.maxIn), int32(3))
+}
+
+func TestRun(t *testing.T) {
+	srv := newServer(t)
+	p := memory.New()
+	store(t, p, "fine", "http://a.example:"+srv.port()+"/", nil)
+
+	c := New(p, newProber(), Options{Interval: time.Hour})
+	defer c.Close()
+
+	// the first round starts right away
+	assert.Eventually(t, func() bool {
+		sd, err := p.Get(context.Background(), "fine")
+		return err == nil && sd.Probe != nil && sd.Probe.StatusCode == http.StatusOK
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestPoliteness(t *testing.T) {
+	hosts := newPoliteness(30 * time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	assert.Nil(t, hosts.wait(ctx, "a.example"))
+	assert.Nil(t, hosts.wait(ctx, "b.example"))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+	assert.Nil(t, hosts.wait(ctx, "a.example"))
+	assert.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.NotNil(t, hosts.wait(ctx, "a.example"))
+}
@@ -0,0 +1,45 @@
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// politeness spaces out the requests to the same host
+type politeness struct {
+	delay time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newPoliteness(delay time.Duration) *politeness {
+	return &politeness{delay: delay, next: map[string]time.Time{}}
+}
+
+// wait blocks until host can be requested again, the slot is reserved before waiting
+// so the concurrent callers for the same host are queued
+func (p *politeness) wait(ctx context.Context, host string) error {
+	p.mu.Lock()
+	now := time.Now()
+	at := p.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	p.next[host] = at.Add(p.delay)
+	p.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
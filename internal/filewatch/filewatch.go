@@ -0,0 +1,88 @@
+// Package filewatch polls files and calls a function whenever one of them changes
+package filewatch
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexadhy/shortener/internal/log"
+)
+
+// Watcher polls the modification time of files on a fixed interval until it is closed
+type Watcher struct {
+	files    []string
+	interval time.Duration
+	fn       func() error
+	modTime  map[string]time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New starts watching files, fn is called once one or more of them changed or disappeared
+// a failing fn is logged and only called again on the next change, Close has to be called to stop watching
+func New(files []string, interval time.Duration, fn func() error) *Watcher {
+	w := &Watcher{
+		files:    files,
+		interval: interval,
+		fn:       fn,
+		modTime:  stat(files),
+		done:     make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// Close stops watching, it waits for fn to return if it is running
+func (w *Watcher) Close() {
+	close(w.done)
+	w.wg.Wait()
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			modTime := stat(w.files)
+			if equal(modTime, w.modTime) {
+				continue
+			}
+			w.modTime = modTime
+			if err := w.fn(); err != nil {
+				log.Errorf("filewatch reload: %v", err)
+			}
+		}
+	}
+}
+
+// stat returns the modification time of the files which exist
+func stat(files []string) map[string]time.Time {
+	res := make(map[string]time.Time, len(files))
+	for _, name := range files {
+		if fi, err := os.Stat(name); err == nil {
+			res[name] = fi.ModTime()
+		}
+	}
+	return res
+}
+
+func equal(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, t := range a {
+		if u, ok := b[name]; !ok || !t.Equal(u) {
+			return false
+		}
+	}
+	return true
+}
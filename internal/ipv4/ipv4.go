@@ -0,0 +1,83 @@
+// Package ipv4 parses hosts the way browsers and resolvers do, following the IPv4 parser of the WHATWG URL standard
+// e.g. 167772161, 10.1, 0x7f.1 and 0177.0.0.1 are all IPv4 addresses, which net.ParseIP doesn't accept
+package ipv4
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is returned for a host ending in a number which isn't a valid IPv4 address, e.g. 1.2.3.256
+var ErrInvalid = errors.New("invalid IPv4 address")
+
+// Parse returns the IPv4 address host stands for, ok is false if host is a domain name
+// a host whose last label is a number is an IPv4 address, ErrInvalid is returned if it can't be parsed as one
+func Parse(host string) (ip net.IP, ok bool, err error) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	if !endsInNumber(parts[len(parts)-1]) {
+		return nil, false, nil
+	}
+	if len(parts) > 4 {
+		return nil, true, ErrInvalid
+	}
+
+	numbers := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := parseNumber(p)
+		if err != nil {
+			return nil, true, ErrInvalid
+		}
+		numbers[i] = n
+	}
+
+	// every part but the last one is a byte, the last one fills the remaining bytes
+	last := numbers[len(numbers)-1]
+	if last >= 1<<(8*(5-len(numbers))) {
+		return nil, true, ErrInvalid
+	}
+	addr := last
+	for i, n := range numbers[:len(numbers)-1] {
+		if n > 255 {
+			return nil, true, ErrInvalid
+		}
+		addr += n << (8 * (3 - i))
+	}
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr)).To4(), true, nil
+}
+
+// endsInNumber reports whether the last label of a host makes it an IPv4 address
+func endsInNumber(label string) bool {
+	if label == "" {
+		return false
+	}
+	if strings.Trim(label, "0123456789") == "" {
+		return true
+	}
+	_, err := parseNumber(label)
+	return err == nil
+}
+
+// parseNumber parses a part of an IPv4 address, in hexadecimal with a 0x prefix, in octal with a leading 0
+func parseNumber(s string) (uint64, error) {
+	base := 10
+	switch {
+	case len(s) >= 2 && (s[:2] == "0x" || s[:2] == "0X"):
+		s, base = s[2:], 16
+		if s == "" {
+			return 0, nil
+		}
+	case len(s) >= 2 && s[0] == '0':
+		s, base = s[1:], 8
+	case s == "":
+		return 0, errors.New("empty part")
+	}
+	if strings.ContainsAny(s, "+-") {
+		return 0, errors.New("signed part")
+	}
+	return strconv.ParseUint(s, base, 64)
+}
@@ -0,0 +1,48 @@
+package ipv4
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantOK  bool
+		wantErr error
+	}{
+		{name: "should parse a dotted quad", input: "10.0.0.1", want: "10.0.0.1", wantOK: true},
+		{name: "should parse a decimal address", input: "167772161", want: "10.0.0.1", wantOK: true},
+		{name: "should parse a shortened address", input: "127.1", want: "127.0.0.1", wantOK: true},
+		{name: "should parse three parts", input: "10.1.257", want: "10.1.1.1", wantOK: true},
+		{name: "should parse hexadecimal parts", input: "0x7f.1", want: "127.0.0.1", wantOK: true},
+		{name: "should parse a hexadecimal address", input: "0x7F000001", want: "127.0.0.1", wantOK: true},
+		{name: "should parse octal parts", input: "0177.0.0.1", want: "127.0.0.1", wantOK: true},
+		{name: "should ignore a trailing dot", input: "127.0.0.1.", want: "127.0.0.1", wantOK: true},
+		{name: "should leave domain names alone", input: "example.com"},
+		{name: "should leave hosts with a numeric label alone", input: "1.example"},
+		{name: "should leave hexadecimal looking labels alone", input: "cafe.0xbeef.com"},
+		{name: "should refuse a part above 255", input: "1.2.3.256", wantOK: true, wantErr: ErrInvalid},
+		{name: "should refuse an address above 32 bits", input: "4294967296", wantOK: true, wantErr: ErrInvalid},
+		{name: "should refuse more than 4 parts", input: "1.2.3.4.5", wantOK: true, wantErr: ErrInvalid},
+		{name: "should refuse invalid octal parts", input: "09.0.0.1", wantOK: true, wantErr: ErrInvalid},
+		{name: "should refuse a domain ending in a number", input: "example.1", wantOK: true, wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, ok, err := Parse(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expecting error %v, got: %v", tt.wantErr, err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("expecting ok %v, got: %v", tt.wantOK, ok)
+			}
+			if tt.want != "" && ip.String() != tt.want {
+				t.Fatalf("expecting %s, got: %s", tt.want, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Package janitor periodically evicts the expired shortened urls of a persistence layer
+package janitor
+
+import (
+	"context"
+	"expvar"
+	"time"
+
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/persist"
+)
+
+const (
+	defaultInterval = 10 * time.Minute
+	sweepTimeout    = 5 * time.Minute
+)
+
+// expiredLinks is the number of shortened urls evicted since the start, exported on /debug/vars
+var expiredLinks = expvar.NewInt("expired_links")
+
+// Janitor calls persist.Persist.Expire on a fixed interval until it is closed
+type Janitor struct {
+	p        persist.Persist
+	interval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a janitor and starts its worker, Close has to be called to stop it
+// interval is defaulted if not positive
+func New(p persist.Persist, interval time.Duration) *Janitor {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Janitor{
+		p:        p,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+// Sweep evicts the expired shortened urls right away and returns how many were evicted
+func (j *Janitor) Sweep(ctx context.Context) (int, error) {
+	n, err := j.p.Expire(ctx)
+	expiredLinks.Add(int64(n))
+	if n > 0 {
+		log.Infof("janitor evicted %d expired links", n)
+	}
+	return n, err
+}
+
+// Close stops the worker, the running sweep if any is cancelled
+func (j *Janitor) Close() {
+	j.cancel()
+	<-j.done
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(j.ctx, sweepTimeout)
+			if _, err := j.Sweep(ctx); err != nil && j.ctx.Err() == nil {
+				log.Errorf("janitor sweep: %v", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/persist"
+)
+
+type fakeStore struct {
+	persist.Persist
+	calls   int32
+	evicted int
+	err     error
+}
+
+func (f *fakeStore) Expire(_ context.Context) (int, error) {
+	atomic.AddInt32(&f.calls, 1)
+	return f.evicted, f.err
+}
+
+func TestSweep(t *testing.T) {
+	tests := []struct {
+		name      string
+		store     *fakeStore
+		wantCount int
+		wantErr   bool
+	}{
+		{
+			name:      "should report the evicted links",
+			store:     &fakeStore{evicted: 3},
+			wantCount: 3,
+		},
+		{
+			name:    "should report the error of the store",
+			store:   &fakeStore{err: errors.New("boom")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := New(tt.store, time.Hour)
+			defer j.Close()
+
+			before := expiredLinks.Value()
+			n, err := j.Sweep(context.Background())
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCount, n)
+			assert.Equal(t, before+int64(tt.wantCount), expiredLinks.Value())
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := &fakeStore{evicted: 1}
+	j := New(store, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&store.calls) >= 2
+	}, time.Second, 5*time.Millisecond)
+
+	j.Close()
+	calls := atomic.LoadInt32(&store.calls)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, calls, atomic.LoadInt32(&store.calls), "no sweep should run once closed")
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -14,17 +16,35 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 
+	"github.com/alexadhy/shortener/analytics"
 	"github.com/alexadhy/shortener/config"
+	"github.com/alexadhy/shortener/domainpolicy"
 	"github.com/alexadhy/shortener/handlers"
+	"github.com/alexadhy/shortener/healthcheck"
 	"github.com/alexadhy/shortener/internal/log"
 	"github.com/alexadhy/shortener/internal/middlewares"
-	"github.com/alexadhy/shortener/persist/badger"
+	"github.com/alexadhy/shortener/janitor"
+	"github.com/alexadhy/shortener/persist"
+	_ "github.com/alexadhy/shortener/persist/badger"
+	_ "github.com/alexadhy/shortener/persist/memory"
+	_ "github.com/alexadhy/shortener/persist/redis"
+	"github.com/alexadhy/shortener/probe"
+	"github.com/alexadhy/shortener/shortcode"
+	"github.com/alexadhy/shortener/threat"
+	"github.com/alexadhy/shortener/urlnorm"
 )
 
 func main() {
-	opts := config.New(func() config.Options {
-		return config.Options{}
-	})
+	configPath := flag.String("config", os.Getenv("APP_CONFIG"), "path to a JSON, YAML or TOML config file")
+	flag.Parse()
+
+	opts, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("config.Load(): %v", err)
+	}
+	if err = opts.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	router := chi.NewRouter()
 	lmt := tollbooth.NewLimiter(1, &limiter.ExpirableOptions{DefaultExpirationTTL: 24 * 7 * time.Hour})
@@ -35,29 +55,114 @@ func main() {
 
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", handlers.PasswordHeader},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
-	//store, err := redis.New(opts.Redis.Addresses...)
-	//if err != nil {
-	//	log.Fatalf("redis.New(): %v", err)
-	//}
+	store, err := persist.Open(opts)
+	if err != nil {
+		log.Fatalf("persist.Open(): %v", err)
+	}
 
-	store, err := badger.New(opts.Badger.Path)
+	gen, err := shortcode.New(opts.Generator.Type, opts.Generator.Length, opts.Generator.Salt)
 	if err != nil {
-		log.Fatalf("badger.New(): %v", err)
+		log.Fatalf("shortcode.New(): %v", err)
 	}
 
-	apiSrv := handlers.New(store, opts.Domain, opts.Expiry, func(s string) bool {
-		return true
+	policy, err := domainpolicy.New(domainpolicy.Options{
+		Allow:          opts.Domains.Allow,
+		Deny:           opts.Domains.Deny,
+		AllowFiles:     opts.Domains.AllowFiles,
+		DenyFiles:      opts.Domains.DenyFiles,
+		ReloadInterval: opts.Domains.ReloadInterval,
 	})
+	if err != nil {
+		log.Fatalf("domainpolicy.New(): %v", err)
+	}
 
-	router.Post("/", apiSrv.CreateShortLink)
-	router.Get("/{id}", apiSrv.HandleRedirect)
+	proxies, err := config.ParseNets(opts.TrustedProxies)
+	if err != nil {
+		log.Fatalf("config.ParseNets(): %v", err)
+	}
+
+	apiOpts := []handlers.Option{
+		handlers.WithGenerator(gen),
+		handlers.WithAdminToken(opts.AdminToken),
+		handlers.WithAliasDomains(opts.AliasDomains...),
+		handlers.WithTrustedProxies(proxies...),
+		handlers.WithRedirectCode(opts.Redirect.Code),
+		handlers.WithPrelaunchURL(opts.Redirect.PrelaunchURL),
+		handlers.WithExpiryBounds(*opts.MinExpiry, opts.MaxExpiry),
+		handlers.WithMaxBatchSize(opts.MaxBatchSize),
+		handlers.WithNormalizer(urlnorm.New(urlnorm.Options{
+			Schemes:       opts.URL.Schemes,
+			StripFragment: opts.URL.StripFragment,
+			SortQuery:     opts.URL.SortQuery,
+		})),
+	}
+
+	prober := probe.New(probe.Options{
+		Timeout:      opts.Probe.Timeout,
+		MaxRedirects: opts.Probe.MaxRedirects,
+	})
+	if opts.Probe.Enabled {
+		apiOpts = append(apiOpts, handlers.WithProber(prober))
+	}
+
+	if opts.TemplatesDir != "" {
+		pages, err := handlers.LoadPages(opts.TemplatesDir)
+		if err != nil {
+			log.Fatalf("handlers.LoadPages(): %v", err)
+		}
+		apiOpts = append(apiOpts, handlers.WithPages(pages))
+	}
+
+	var recorder *analytics.Recorder
+	var eventsFile *os.File
+	if statsStore, ok := store.(persist.StatsStore); ok && !opts.Analytics.Disabled {
+		var eventLog io.Writer
+		if opts.Analytics.EventsFile != "" {
+			eventsFile, err = os.OpenFile(opts.Analytics.EventsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				log.Fatalf("analytics events file: %v", err)
+			}
+			eventLog = eventsFile
+		}
+		recorder = analytics.NewRecorder(statsStore, opts.Analytics.BufferSize, opts.Analytics.FlushInterval, eventLog)
+		apiOpts = append(apiOpts, handlers.WithAnalytics(recorder))
+	}
+
+	var screener *threat.Screener
+	if opts.Threats.Enabled() {
+		screener, err = threat.New(threat.Options{
+			HostFiles:       opts.Threats.HostFiles,
+			URLPrefixFiles:  opts.Threats.URLPrefixFiles,
+			HashPrefixFiles: opts.Threats.HashPrefixFiles,
+			ReloadInterval:  opts.Threats.ReloadInterval,
+		}, store)
+		if err != nil {
+			log.Fatalf("threat.New(): %v", err)
+		}
+		apiOpts = append(apiOpts, handlers.WithScreener(screener, opts.Threats.CheckRedirects))
+	}
+
+	sweeper := janitor.New(store, opts.ExpireInterval)
+
+	var checker *healthcheck.Checker
+	if opts.HealthCheck.Enabled {
+		checker = healthcheck.New(store, prober, healthcheck.Options{
+			Interval:    opts.HealthCheck.Interval,
+			Concurrency: opts.HealthCheck.Concurrency,
+			HostDelay:   opts.HealthCheck.HostDelay,
+		})
+	}
+
+	apiSrv := handlers.New(store, opts.Domain, *opts.Expiry, policy.Allowed, apiOpts...)
+
+	apiSrv.Routes(router)
 
 	server := http.Server{Addr: opts.Host + ":" + opts.Port, Handler: router}
 
@@ -71,11 +176,11 @@ func main() {
 		<-sig
 
 		// Shutdown signal with grace period of 30 seconds
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
+		defer cancel()
 
 		go func() {
 			<-shutdownCtx.Done()
-			_ = store.Shutdown()
 			if shutdownCtx.Err() == context.DeadlineExceeded {
 				log.Fatal("graceful shutdown timed out.. forcing exit.")
 			}
@@ -86,6 +191,24 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		// no request is in flight anymore, the pending clicks are flushed and the workers stopped
+		// before the store they all use is closed
+		if recorder != nil {
+			recorder.Close()
+		}
+		if eventsFile != nil {
+			_ = eventsFile.Close()
+		}
+		sweeper.Close()
+		if checker != nil {
+			checker.Close()
+		}
+		policy.Close()
+		if screener != nil {
+			screener.Close()
+		}
+		_ = store.Shutdown()
 		serverStopCtx()
 	}()
 
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	minAliasLen = 3
+	maxAliasLen = 64
+)
+
+var (
+	// ErrInvalidAlias is returned when a custom alias contains characters outside of the allowed set
+	ErrInvalidAlias = errors.New("alias may only contain letters, digits, '-' and '_', and must start with a letter or digit")
+	// ErrAliasLength is returned when a custom alias is too short or too long
+	ErrAliasLength = errors.New("alias must be between 3 and 64 characters long")
+	// ErrReservedAlias is returned when a custom alias collides with a reserved word
+	ErrReservedAlias = errors.New("alias is reserved")
+
+	// reservedAliases are kept for current and future routes, compared case-insensitively
+	reservedAliases = map[string]struct{}{
+		"api":      {},
+		"admin":    {},
+		"assets":   {},
+		"static":   {},
+		"debug":    {},
+		"health":   {},
+		"healthz":  {},
+		"metrics":  {},
+		"login":    {},
+		"logout":   {},
+		"register": {},
+		"settings": {},
+		"stats":    {},
+		"docs":     {},
+		"broken":   {},
+	}
+)
+
+// ValidateAlias checks that alias can be used as a custom short code
+func ValidateAlias(alias string) error {
+	if len(alias) < minAliasLen || len(alias) > maxAliasLen {
+		return ErrAliasLength
+	}
+
+	for i := 0; i < len(alias); i++ {
+		c := alias[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case (c == '-' || c == '_') && i > 0:
+		default:
+			return ErrInvalidAlias
+		}
+	}
+
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return ErrReservedAlias
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{
+			name:    "should accept a regular alias",
+			input:   "q3-report",
+			wantErr: nil,
+		},
+		{
+			name:    "should reject an alias that is too short",
+			input:   "ab",
+			wantErr: model.ErrAliasLength,
+		},
+		{
+			name:    "should reject an alias with invalid characters",
+			input:   "q3/report",
+			wantErr: model.ErrInvalidAlias,
+		},
+		{
+			name:    "should reject an alias starting with a separator",
+			input:   "-report",
+			wantErr: model.ErrInvalidAlias,
+		},
+		{
+			name:    "should reject reserved words regardless of case",
+			input:   "API",
+			wantErr: model.ErrReservedAlias,
+		},
+		{
+			name:    "should reject the names of the api routes",
+			input:   "broken",
+			wantErr: model.ErrReservedAlias,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := model.ValidateAlias(tt.input); err != tt.wantErr {
+				t.Fatalf("expecting %v, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/alexadhy/shortener/internal/hash"
+)
+
+const ownerTokenLen = 32
+
+// NewOwnerToken creates a secret token used to manage the shortened url
+// only its digest is kept on the record, the token itself is handed out once to the creator
+func (s *ShortenedData) NewOwnerToken() (string, error) {
+	b := make([]byte, ownerTokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	s.Owner = ownerDigest(token)
+	return token, nil
+}
+
+// IsOwner reports whether token is the one that was issued by NewOwnerToken
+// records without an owner can't be managed
+func (s *ShortenedData) IsOwner(token string) bool {
+	if s.Owner == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.Owner), []byte(ownerDigest(token))) == 1
+}
+
+func ownerDigest(token string) string {
+	sum, _ := hash.Hash(token)
+	return sum
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLen is the longest password bcrypt can hash
+const maxPasswordLen = 72
+
+// ErrPasswordLength is returned for a password longer than 72 bytes
+var ErrPasswordLength = errors.New("password can't be longer than 72 bytes")
+
+// HashPassword returns the bcrypt hash of password to be set with SetPasswordHash, an empty password gives an empty hash
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordLen {
+		return "", ErrPasswordLength
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// SetPassword protects the shortened url with password, only its bcrypt hash is kept on the record
+// an empty password removes the protection
+func (s *ShortenedData) SetPassword(password string) error {
+	h, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.SetPasswordHash(h)
+	return nil
+}
+
+// SetPasswordHash sets a hash returned by HashPassword, it is cheap enough to be called while holding a lock
+func (s *ShortenedData) SetPasswordHash(h string) {
+	s.Password = h
+	s.Rehash()
+}
+
+// Protected reports whether a password is required to follow the shortened url
+func (s *ShortenedData) Protected() bool {
+	return s.Password != ""
+}
+
+// CheckPassword reports whether password is the one set by SetPassword
+func (s *ShortenedData) CheckPassword(password string) bool {
+	if !s.Protected() || password == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(s.Password), []byte(password)) == nil
+}
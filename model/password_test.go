@@ -0,0 +1,43 @@
+package model_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+func TestPassword(t *testing.T) {
+	public, err := model.New("https://example.com/doc", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected, err := model.New("https://example.com/doc", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = protected.SetPassword("s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if public.Protected() || public.CheckPassword("s3cret") {
+		t.Fatalf("links without password should not be protected")
+	}
+	if !protected.Protected() || strings.Contains(protected.Password, "s3cret") {
+		t.Fatalf("only the hash of the password should be stored, got: %q", protected.Password)
+	}
+	if !protected.CheckPassword("s3cret") || protected.CheckPassword("guess") || protected.CheckPassword("") {
+		t.Fatalf("only the right password should be accepted")
+	}
+	if protected.Hash == public.Hash {
+		t.Fatalf("protected links should never share the hash of a public link")
+	}
+
+	if err = protected.SetPassword(strings.Repeat("a", 73)); err != model.ErrPasswordLength {
+		t.Fatalf("expecting ErrPasswordLength, got: %v", err)
+	}
+	if err = protected.SetPassword(""); err != nil || protected.Protected() || protected.Hash != public.Hash {
+		t.Fatalf("an empty password should remove the protection, got: %v", err)
+	}
+}
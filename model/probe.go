@@ -0,0 +1,15 @@
+package model
+
+import "net/http"
+
+// Broken reports whether the destination checked by p doesn't work
+// authentication and rate limiting errors don't count, the destination answered but not to an anonymous bot
+func (p *Probe) Broken() bool {
+	switch {
+	case p.Error != "":
+		return true
+	case p.StatusCode == http.StatusNotFound, p.StatusCode == http.StatusGone:
+		return true
+	}
+	return p.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,31 @@
+package model_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+func TestProbeBroken(t *testing.T) {
+	tests := []struct {
+		probe  model.Probe
+		broken bool
+	}{
+		{probe: model.Probe{StatusCode: http.StatusOK}, broken: false},
+		{probe: model.Probe{StatusCode: http.StatusNoContent}, broken: false},
+		{probe: model.Probe{StatusCode: http.StatusUnauthorized}, broken: false},
+		{probe: model.Probe{StatusCode: http.StatusForbidden}, broken: false},
+		{probe: model.Probe{StatusCode: http.StatusTooManyRequests}, broken: false},
+		{probe: model.Probe{StatusCode: http.StatusNotFound}, broken: true},
+		{probe: model.Probe{StatusCode: http.StatusGone}, broken: true},
+		{probe: model.Probe{StatusCode: http.StatusBadGateway}, broken: true},
+		{probe: model.Probe{Error: "connection refused"}, broken: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.probe.Broken(); got != tt.broken {
+			t.Errorf("Broken() of %+v = %v, want %v", tt.probe, got, tt.broken)
+		}
+	}
+}
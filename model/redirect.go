@@ -0,0 +1,24 @@
+package model
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidRedirect is returned when a redirect status code is not one of 301, 302, 307 or 308
+var ErrInvalidRedirect = errors.New("redirect code has to be one of 301, 302, 307 or 308")
+
+// ValidateRedirectCode checks that code can be used to redirect, 0 means the default of the server
+func ValidateRedirectCode(code int) error {
+	switch code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	default:
+		return ErrInvalidRedirect
+	}
+}
+
+// IsPermanentRedirect reports whether clients are allowed to cache a redirect with the status code
+func IsPermanentRedirect(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
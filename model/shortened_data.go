@@ -2,12 +2,17 @@
 package model
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/alexadhy/shortener/internal/hash"
+	"github.com/alexadhy/shortener/shortcode"
 )
 
 var (
@@ -29,35 +34,188 @@ var (
 )
 
 // ShortenedData is the structure that will be used to store to persistence layer
-// It will be stored in the format of msgpack
+// It will be stored in the format of msgpack, Expiry is the zero time for links which never expire
+// NotBefore is when the link starts redirecting, the zero time for links which are active right away
 type ShortenedData struct {
-	Key    string    `msg:"-"`
-	Orig   string    `msg:"original"`
-	Hash   string    `msg:"hash"`
-	Short  string    `msg:"short"`
-	Expiry time.Time `msg:"expiry"`
+	Key       string    `msg:"-"`
+	Orig      string    `msg:"original"`
+	Hash      string    `msg:"hash"`
+	Short     string    `msg:"short"`
+	Expiry    time.Time `msg:"expiry"`
+	NotBefore time.Time `msg:"not_before"`
+	Custom    bool      `msg:"custom"`
+	Owner     string    `msg:"owner"`
+	// Shared is set once the link was handed out to someone else than its owner, for the same URL
+	// its destination then can't be changed by the owner anymore
+	Shared bool `msg:"shared"`
+	// RedirectCode is the status code used to redirect, 0 means the default of the server
+	RedirectCode int `msg:"redirect_code"`
+	// Fallback is where the link redirects to once expired, it is kept for FallbackRetention after its expiry
+	Fallback string `msg:"fallback"`
+	// Password is the bcrypt hash of the password protecting the link, see SetPassword
+	Password string `msg:"password"`
+	// MaxUses is how many times the link can be followed, 0 means unlimited, see Consume
+	MaxUses int `msg:"max_uses"`
+	Uses    int `msg:"uses"`
+	// Nonce is part of Hash for the links which must never be deduplicated, see MakeUnique
+	Nonce string `msg:"nonce"`
+	// Prelaunch is where the link redirects to until NotBefore
+	Prelaunch string `msg:"prelaunch"`
+	// Created is when the link was created, the zero time for links created before it was recorded
+	Created time.Time `msg:"created"`
+	// Blocked is why the link was disabled, e.g. its destination got listed as malicious, empty if it wasn't
+	Blocked string `msg:"blocked"`
+	// Probe is the outcome of the last reachability check of the destination, nil if it was never checked
+	Probe *Probe `msg:"probe"`
 }
 
-const (
-	defaultExpiry = 24 * 30 * time.Hour
-	minExpiry     = 5 * time.Minute
-)
+// Probe is the outcome of a reachability check of a destination, see package probe
+// StatusCode is the one of the last response after following the redirects to FinalURL, Error is set if there was none
+type Probe struct {
+	StatusCode int       `msg:"status_code"`
+	FinalURL   string    `msg:"final_url"`
+	Error      string    `msg:"error"`
+	Checked    time.Time `msg:"checked"`
+}
+
+// DefaultGenerator is the short code generator used by New
+var DefaultGenerator shortcode.Generator = shortcode.Hash{}
+
+// ErrInvalidExpiry is returned for a negative ttl
+var ErrInvalidExpiry = errors.New("ttl can't be negative")
+
+// FallbackRetention is how long a link with a fallback URL is kept after its expiry
+const FallbackRetention = 365 * 24 * time.Hour
 
 // New takes an original URL and returns *ShortenedData and error if any
+// the link expires after ttl, or never if ttl is 0
 func New(orig string, ttl time.Duration) (*ShortenedData, error) {
-	if ttl < minExpiry {
-		ttl = defaultExpiry
+	return NewWithGenerator(orig, ttl, DefaultGenerator)
+}
+
+// NewWithGenerator is like New, but the short code is generated by g
+func NewWithGenerator(orig string, ttl time.Duration, g shortcode.Generator) (*ShortenedData, error) {
+	if ttl < 0 {
+		return nil, ErrInvalidExpiry
+	}
+
+	now := time.Now().UTC()
+	s := &ShortenedData{Orig: orig, Created: now}
+	if ttl > 0 {
+		s.Expiry = now.Add(ttl)
+	}
+
+	s.Rehash()
+	if err := s.Regenerate(g, 0); err != nil {
+		return nil, err
 	}
 
-	s := &ShortenedData{
-		Orig:   orig,
-		Expiry: time.Now().UTC().Add(ttl),
+	return s, nil
+}
+
+// Rehash derives Hash from the destination, it has to be called whenever Orig, RedirectCode, Fallback, Password or Nonce change
+// the password hash is part of it for protected links, so that they are never deduplicated with another link,
+// and so are a redirect code and a fallback, a link redirecting differently isn't the same link
+func (s *ShortenedData) Rehash() {
+	src := s.Orig
+	if s.RedirectCode != 0 {
+		src += "\x00code=" + strconv.Itoa(s.RedirectCode)
+	}
+	if s.Fallback != "" {
+		src += "\x00fallback=" + s.Fallback
+	}
+	if s.Password != "" {
+		src += "\x00" + s.Password
+	}
+	if s.Nonce != "" {
+		src += "\x00" + s.Nonce
 	}
+	s.Hash, _ = hash.Hash(src)
+}
+
+// MakeUnique makes sure the link is never deduplicated with another one pointing to the same URL
+// e.g. a one-time link can't be handed out twice
+func (s *ShortenedData) MakeUnique() error {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return err
+	}
+	s.Nonce = hex.EncodeToString(b)
+	s.Rehash()
+	return nil
+}
+
+// Unique reports whether the link is never deduplicated with another one, i.e. it is protected or made unique
+func (s *ShortenedData) Unique() bool {
+	return s.Nonce != "" || s.Password != ""
+}
 
-	sum, short := hash.Hash(orig)
+// Distinct reports whether Hash covers more than Orig, such links get their codes from Hash
+// so that they don't compete for the codes of the plain link to the same URL
+func (s *ShortenedData) Distinct() bool {
+	return s.Unique() || s.RedirectCode != 0 || s.Fallback != ""
+}
+
+// ExpiredAt reports whether the link is expired at t, links without expiry never are
+func (s *ShortenedData) ExpiredAt(t time.Time) bool {
+	return !s.Expiry.IsZero() && !t.Before(s.Expiry)
+}
+
+// ActiveAt reports whether the link redirects at t, i.e. it isn't scheduled for later
+func (s *ShortenedData) ActiveAt(t time.Time) bool {
+	return s.NotBefore.IsZero() || !t.Before(s.NotBefore)
+}
+
+// EvictAt returns when the link can be removed from the storage, the zero time if it never can
+func (s *ShortenedData) EvictAt() time.Time {
+	if s.Expiry.IsZero() || s.Fallback == "" {
+		return s.Expiry
+	}
+	return s.Expiry.Add(FallbackRetention)
+}
+
+// EvictableAt reports whether the link can be removed from the storage at t
+func (s *ShortenedData) EvictableAt(t time.Time) bool {
+	evictAt := s.EvictAt()
+	return !evictAt.IsZero() && !t.Before(evictAt)
+}
+
+// Regenerate replaces the short code with the one generated by g for the given attempt
+// it is used to derive an alternate code after the current one collided with a different URL,
+// and has to be called once a link became unique so that it doesn't compete for the codes of its URL
+// the codes of distinct links are derived from Hash, the other links always get the same codes for the same URL
+func (s *ShortenedData) Regenerate(g shortcode.Generator, attempt int) error {
+	if s.Custom {
+		return errors.New("custom aliases can't be regenerated")
+	}
+
+	src := s.Orig
+	if s.Distinct() {
+		src = s.Hash
+	}
+	short, err := g.Generate(src, attempt)
+	if err != nil {
+		return err
+	}
 	s.Short = short
 	s.Key = short
-	s.Hash = sum
+	return nil
+}
+
+// NewAlias takes an original URL and a user chosen alias and returns *ShortenedData and error if any
+// the alias is used as the short code instead of the one derived from the hash
+func NewAlias(orig, alias string, ttl time.Duration) (*ShortenedData, error) {
+	if err := ValidateAlias(alias); err != nil {
+		return nil, err
+	}
+
+	s, err := New(orig, ttl)
+	if err != nil {
+		return nil, err
+	}
+	s.Short = alias
+	s.Key = alias
+	s.Custom = true
 
 	return s, nil
 }
@@ -123,3 +281,13 @@ func randomString(n int) string {
 
 	return sb.String()
 }
+
+// UTC converts the times of s to UTC, msgp decodes them in the local time zone
+func (s *ShortenedData) UTC() {
+	s.Expiry = s.Expiry.UTC()
+	s.NotBefore = s.NotBefore.UTC()
+	s.Created = s.Created.UTC()
+	if s.Probe != nil {
+		s.Probe.Checked = s.Probe.Checked.UTC()
+	}
+}
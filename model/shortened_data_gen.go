@@ -6,6 +6,184 @@ import (
 	"github.com/tinylib/msgp/msgp"
 )
 
+// DecodeMsg implements msgp.Decodable
+func (z *Probe) DecodeMsg(dc *msgp.Reader) (err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "status_code":
+			z.StatusCode, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "StatusCode")
+				return
+			}
+		case "final_url":
+			z.FinalURL, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "FinalURL")
+				return
+			}
+		case "error":
+			z.Error, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Error")
+				return
+			}
+		case "checked":
+			z.Checked, err = dc.ReadTime()
+			if err != nil {
+				err = msgp.WrapError(err, "Checked")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	return
+}
+
+// EncodeMsg implements msgp.Encodable
+func (z *Probe) EncodeMsg(en *msgp.Writer) (err error) {
+	// map header, size 4
+	// write "status_code"
+	err = en.Append(0x84, 0xab, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f, 0x63, 0x6f, 0x64, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.StatusCode)
+	if err != nil {
+		err = msgp.WrapError(err, "StatusCode")
+		return
+	}
+	// write "final_url"
+	err = en.Append(0xa9, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x5f, 0x75, 0x72, 0x6c)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.FinalURL)
+	if err != nil {
+		err = msgp.WrapError(err, "FinalURL")
+		return
+	}
+	// write "error"
+	err = en.Append(0xa5, 0x65, 0x72, 0x72, 0x6f, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Error)
+	if err != nil {
+		err = msgp.WrapError(err, "Error")
+		return
+	}
+	// write "checked"
+	err = en.Append(0xa7, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteTime(z.Checked)
+	if err != nil {
+		err = msgp.WrapError(err, "Checked")
+		return
+	}
+	return
+}
+
+// MarshalMsg implements msgp.Marshaler
+func (z *Probe) MarshalMsg(b []byte) (o []byte, err error) {
+	o = msgp.Require(b, z.Msgsize())
+	// map header, size 4
+	// string "status_code"
+	o = append(o, 0x84, 0xab, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x5f, 0x63, 0x6f, 0x64, 0x65)
+	o = msgp.AppendInt(o, z.StatusCode)
+	// string "final_url"
+	o = append(o, 0xa9, 0x66, 0x69, 0x6e, 0x61, 0x6c, 0x5f, 0x75, 0x72, 0x6c)
+	o = msgp.AppendString(o, z.FinalURL)
+	// string "error"
+	o = append(o, 0xa5, 0x65, 0x72, 0x72, 0x6f, 0x72)
+	o = msgp.AppendString(o, z.Error)
+	// string "checked"
+	o = append(o, 0xa7, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x64)
+	o = msgp.AppendTime(o, z.Checked)
+	return
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler
+func (z *Probe) UnmarshalMsg(bts []byte) (o []byte, err error) {
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		err = msgp.WrapError(err)
+		return
+	}
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			err = msgp.WrapError(err)
+			return
+		}
+		switch msgp.UnsafeString(field) {
+		case "status_code":
+			z.StatusCode, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "StatusCode")
+				return
+			}
+		case "final_url":
+			z.FinalURL, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "FinalURL")
+				return
+			}
+		case "error":
+			z.Error, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Error")
+				return
+			}
+		case "checked":
+			z.Checked, bts, err = msgp.ReadTimeBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Checked")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
+	}
+	o = bts
+	return
+}
+
+// Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
+func (z *Probe) Msgsize() (s int) {
+	s = 1 + 12 + msgp.IntSize + 10 + msgp.StringPrefixSize + len(z.FinalURL) + 6 + msgp.StringPrefixSize + len(z.Error) + 8 + msgp.TimeSize
+	return
+}
+
 // DecodeMsg implements msgp.Decodable
 func (z *ShortenedData) DecodeMsg(dc *msgp.Reader) (err error) {
 	var field []byte
@@ -48,6 +226,102 @@ func (z *ShortenedData) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "Expiry")
 				return
 			}
+		case "not_before":
+			z.NotBefore, err = dc.ReadTime()
+			if err != nil {
+				err = msgp.WrapError(err, "NotBefore")
+				return
+			}
+		case "custom":
+			z.Custom, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Custom")
+				return
+			}
+		case "owner":
+			z.Owner, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "shared":
+			z.Shared, err = dc.ReadBool()
+			if err != nil {
+				err = msgp.WrapError(err, "Shared")
+				return
+			}
+		case "redirect_code":
+			z.RedirectCode, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "RedirectCode")
+				return
+			}
+		case "fallback":
+			z.Fallback, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Fallback")
+				return
+			}
+		case "password":
+			z.Password, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Password")
+				return
+			}
+		case "max_uses":
+			z.MaxUses, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "MaxUses")
+				return
+			}
+		case "uses":
+			z.Uses, err = dc.ReadInt()
+			if err != nil {
+				err = msgp.WrapError(err, "Uses")
+				return
+			}
+		case "nonce":
+			z.Nonce, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Nonce")
+				return
+			}
+		case "prelaunch":
+			z.Prelaunch, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Prelaunch")
+				return
+			}
+		case "created":
+			z.Created, err = dc.ReadTime()
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "blocked":
+			z.Blocked, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Blocked")
+				return
+			}
+		case "probe":
+			if dc.IsNil() {
+				err = dc.ReadNil()
+				if err != nil {
+					err = msgp.WrapError(err, "Probe")
+					return
+				}
+				z.Probe = nil
+			} else {
+				if z.Probe == nil {
+					z.Probe = new(Probe)
+				}
+				err = z.Probe.DecodeMsg(dc)
+				if err != nil {
+					err = msgp.WrapError(err, "Probe")
+					return
+				}
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -61,9 +335,9 @@ func (z *ShortenedData) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *ShortenedData) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 4
+	// map header, size 18
 	// write "original"
-	err = en.Append(0x84, 0xa8, 0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c)
+	err = en.Append(0xde, 0x0, 0x12, 0xa8, 0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c)
 	if err != nil {
 		return
 	}
@@ -102,15 +376,162 @@ func (z *ShortenedData) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "Expiry")
 		return
 	}
+	// write "not_before"
+	err = en.Append(0xaa, 0x6e, 0x6f, 0x74, 0x5f, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteTime(z.NotBefore)
+	if err != nil {
+		err = msgp.WrapError(err, "NotBefore")
+		return
+	}
+	// write "custom"
+	err = en.Append(0xa6, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Custom)
+	if err != nil {
+		err = msgp.WrapError(err, "Custom")
+		return
+	}
+	// write "owner"
+	err = en.Append(0xa5, 0x6f, 0x77, 0x6e, 0x65, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Owner)
+	if err != nil {
+		err = msgp.WrapError(err, "Owner")
+		return
+	}
+	// write "shared"
+	err = en.Append(0xa6, 0x73, 0x68, 0x61, 0x72, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteBool(z.Shared)
+	if err != nil {
+		err = msgp.WrapError(err, "Shared")
+		return
+	}
+	// write "redirect_code"
+	err = en.Append(0xad, 0x72, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x5f, 0x63, 0x6f, 0x64, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.RedirectCode)
+	if err != nil {
+		err = msgp.WrapError(err, "RedirectCode")
+		return
+	}
+	// write "fallback"
+	err = en.Append(0xa8, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Fallback)
+	if err != nil {
+		err = msgp.WrapError(err, "Fallback")
+		return
+	}
+	// write "password"
+	err = en.Append(0xa8, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Password)
+	if err != nil {
+		err = msgp.WrapError(err, "Password")
+		return
+	}
+	// write "max_uses"
+	err = en.Append(0xa8, 0x6d, 0x61, 0x78, 0x5f, 0x75, 0x73, 0x65, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.MaxUses)
+	if err != nil {
+		err = msgp.WrapError(err, "MaxUses")
+		return
+	}
+	// write "uses"
+	err = en.Append(0xa4, 0x75, 0x73, 0x65, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteInt(z.Uses)
+	if err != nil {
+		err = msgp.WrapError(err, "Uses")
+		return
+	}
+	// write "nonce"
+	err = en.Append(0xa5, 0x6e, 0x6f, 0x6e, 0x63, 0x65)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Nonce)
+	if err != nil {
+		err = msgp.WrapError(err, "Nonce")
+		return
+	}
+	// write "prelaunch"
+	err = en.Append(0xa9, 0x70, 0x72, 0x65, 0x6c, 0x61, 0x75, 0x6e, 0x63, 0x68)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Prelaunch)
+	if err != nil {
+		err = msgp.WrapError(err, "Prelaunch")
+		return
+	}
+	// write "created"
+	err = en.Append(0xa7, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteTime(z.Created)
+	if err != nil {
+		err = msgp.WrapError(err, "Created")
+		return
+	}
+	// write "blocked"
+	err = en.Append(0xa7, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Blocked)
+	if err != nil {
+		err = msgp.WrapError(err, "Blocked")
+		return
+	}
+	// write "probe"
+	err = en.Append(0xa5, 0x70, 0x72, 0x6f, 0x62, 0x65)
+	if err != nil {
+		return
+	}
+	if z.Probe == nil {
+		err = en.WriteNil()
+		if err != nil {
+			return
+		}
+	} else {
+		err = z.Probe.EncodeMsg(en)
+		if err != nil {
+			err = msgp.WrapError(err, "Probe")
+			return
+		}
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *ShortenedData) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 4
+	// map header, size 18
 	// string "original"
-	o = append(o, 0x84, 0xa8, 0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c)
+	o = append(o, 0xde, 0x0, 0x12, 0xa8, 0x6f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x61, 0x6c)
 	o = msgp.AppendString(o, z.Orig)
 	// string "hash"
 	o = append(o, 0xa4, 0x68, 0x61, 0x73, 0x68)
@@ -121,6 +542,56 @@ func (z *ShortenedData) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "expiry"
 	o = append(o, 0xa6, 0x65, 0x78, 0x70, 0x69, 0x72, 0x79)
 	o = msgp.AppendTime(o, z.Expiry)
+	// string "not_before"
+	o = append(o, 0xaa, 0x6e, 0x6f, 0x74, 0x5f, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65)
+	o = msgp.AppendTime(o, z.NotBefore)
+	// string "custom"
+	o = append(o, 0xa6, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d)
+	o = msgp.AppendBool(o, z.Custom)
+	// string "owner"
+	o = append(o, 0xa5, 0x6f, 0x77, 0x6e, 0x65, 0x72)
+	o = msgp.AppendString(o, z.Owner)
+	// string "shared"
+	o = append(o, 0xa6, 0x73, 0x68, 0x61, 0x72, 0x65, 0x64)
+	o = msgp.AppendBool(o, z.Shared)
+	// string "redirect_code"
+	o = append(o, 0xad, 0x72, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x5f, 0x63, 0x6f, 0x64, 0x65)
+	o = msgp.AppendInt(o, z.RedirectCode)
+	// string "fallback"
+	o = append(o, 0xa8, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b)
+	o = msgp.AppendString(o, z.Fallback)
+	// string "password"
+	o = append(o, 0xa8, 0x70, 0x61, 0x73, 0x73, 0x77, 0x6f, 0x72, 0x64)
+	o = msgp.AppendString(o, z.Password)
+	// string "max_uses"
+	o = append(o, 0xa8, 0x6d, 0x61, 0x78, 0x5f, 0x75, 0x73, 0x65, 0x73)
+	o = msgp.AppendInt(o, z.MaxUses)
+	// string "uses"
+	o = append(o, 0xa4, 0x75, 0x73, 0x65, 0x73)
+	o = msgp.AppendInt(o, z.Uses)
+	// string "nonce"
+	o = append(o, 0xa5, 0x6e, 0x6f, 0x6e, 0x63, 0x65)
+	o = msgp.AppendString(o, z.Nonce)
+	// string "prelaunch"
+	o = append(o, 0xa9, 0x70, 0x72, 0x65, 0x6c, 0x61, 0x75, 0x6e, 0x63, 0x68)
+	o = msgp.AppendString(o, z.Prelaunch)
+	// string "created"
+	o = append(o, 0xa7, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64)
+	o = msgp.AppendTime(o, z.Created)
+	// string "blocked"
+	o = append(o, 0xa7, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x65, 0x64)
+	o = msgp.AppendString(o, z.Blocked)
+	// string "probe"
+	o = append(o, 0xa5, 0x70, 0x72, 0x6f, 0x62, 0x65)
+	if z.Probe == nil {
+		o = msgp.AppendNil(o)
+	} else {
+		o, err = z.Probe.MarshalMsg(o)
+		if err != nil {
+			err = msgp.WrapError(err, "Probe")
+			return
+		}
+	}
 	return
 }
 
@@ -166,6 +637,101 @@ func (z *ShortenedData) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "Expiry")
 				return
 			}
+		case "not_before":
+			z.NotBefore, bts, err = msgp.ReadTimeBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "NotBefore")
+				return
+			}
+		case "custom":
+			z.Custom, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Custom")
+				return
+			}
+		case "owner":
+			z.Owner, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Owner")
+				return
+			}
+		case "shared":
+			z.Shared, bts, err = msgp.ReadBoolBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Shared")
+				return
+			}
+		case "redirect_code":
+			z.RedirectCode, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "RedirectCode")
+				return
+			}
+		case "fallback":
+			z.Fallback, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Fallback")
+				return
+			}
+		case "password":
+			z.Password, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Password")
+				return
+			}
+		case "max_uses":
+			z.MaxUses, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "MaxUses")
+				return
+			}
+		case "uses":
+			z.Uses, bts, err = msgp.ReadIntBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Uses")
+				return
+			}
+		case "nonce":
+			z.Nonce, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Nonce")
+				return
+			}
+		case "prelaunch":
+			z.Prelaunch, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Prelaunch")
+				return
+			}
+		case "created":
+			z.Created, bts, err = msgp.ReadTimeBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Created")
+				return
+			}
+		case "blocked":
+			z.Blocked, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Blocked")
+				return
+			}
+		case "probe":
+			if msgp.IsNil(bts) {
+				bts, err = msgp.ReadNilBytes(bts)
+				if err != nil {
+					return
+				}
+				z.Probe = nil
+			} else {
+				if z.Probe == nil {
+					z.Probe = new(Probe)
+				}
+				bts, err = z.Probe.UnmarshalMsg(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Probe")
+					return
+				}
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -180,6 +746,11 @@ func (z *ShortenedData) UnmarshalMsg(bts []byte) (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z *ShortenedData) Msgsize() (s int) {
-	s = 1 + 9 + msgp.StringPrefixSize + len(z.Orig) + 5 + msgp.StringPrefixSize + len(z.Hash) + 6 + msgp.StringPrefixSize + len(z.Short) + 7 + msgp.TimeSize
+	s = 3 + 9 + msgp.StringPrefixSize + len(z.Orig) + 5 + msgp.StringPrefixSize + len(z.Hash) + 6 + msgp.StringPrefixSize + len(z.Short) + 7 + msgp.TimeSize + 11 + msgp.TimeSize + 7 + msgp.BoolSize + 6 + msgp.StringPrefixSize + len(z.Owner) + 7 + msgp.BoolSize + 14 + msgp.IntSize + 9 + msgp.StringPrefixSize + len(z.Fallback) + 9 + msgp.StringPrefixSize + len(z.Password) + 9 + msgp.IntSize + 5 + msgp.IntSize + 6 + msgp.StringPrefixSize + len(z.Nonce) + 10 + msgp.StringPrefixSize + len(z.Prelaunch) + 8 + msgp.TimeSize + 8 + msgp.StringPrefixSize + len(z.Blocked) + 6
+	if z.Probe == nil {
+		s += msgp.NilSize
+	} else {
+		s += z.Probe.Msgsize()
+	}
 	return
 }
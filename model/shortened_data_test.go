@@ -1,8 +1,12 @@
 package model_test
 
 import (
-	"github.com/alexadhy/shortener/model"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/shortcode"
 )
 
 func TestGenFake(t *testing.T) {
@@ -38,3 +42,54 @@ func TestGenFake(t *testing.T) {
 		})
 	}
 }
+
+func TestRegenerate(t *testing.T) {
+	gen := shortcode.GeneratorFunc(func(orig string, attempt int) (string, error) {
+		return "CODE" + strconv.Itoa(attempt), nil
+	})
+
+	sd, err := model.NewWithGenerator("https://example.com", time.Hour, gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Short != "CODE0" || sd.Key != "CODE0" {
+		t.Fatalf("expecting CODE0, got: %s", sd.Short)
+	}
+
+	if err = sd.Regenerate(gen, 1); err != nil {
+		t.Fatal(err)
+	}
+	if sd.Short != "CODE1" || sd.Key != "CODE1" {
+		t.Fatalf("expecting CODE1, got: %s", sd.Short)
+	}
+
+	alias, err := model.NewAlias("https://example.com", "my-alias", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = alias.Regenerate(gen, 1); err == nil {
+		t.Fatalf("custom aliases should never be regenerated")
+	}
+}
+
+func TestNewExpiry(t *testing.T) {
+	sd, err := model.New("https://example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.ExpiredAt(time.Now()) || !sd.ExpiredAt(time.Now().Add(2*time.Hour)) {
+		t.Fatalf("expecting the link to expire in an hour, got: %v", sd.Expiry)
+	}
+
+	sd, err = model.New("https://example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sd.Expiry.IsZero() || sd.ExpiredAt(time.Now().AddDate(100, 0, 0)) {
+		t.Fatalf("expecting the link to never expire, got: %v", sd.Expiry)
+	}
+
+	if _, err = model.New("https://example.com", -time.Hour); err != model.ErrInvalidExpiry {
+		t.Fatalf("expecting ErrInvalidExpiry, got: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Granularities of the click counters
+const (
+	Hourly = "hour"
+	Daily  = "day"
+)
+
+// ClickCount is the number of clicks on a shortened url during the bucket starting at Start
+type ClickCount struct {
+	Granularity string
+	Start       time.Time
+	Count       int64
+}
+
+// BucketStart returns the start of the bucket of the given granularity t falls in
+func BucketStart(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	if granularity == Daily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
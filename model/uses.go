@@ -0,0 +1,28 @@
+package model
+
+import "errors"
+
+// ErrUsedUp is returned by Consume once the link has been followed MaxUses times
+var ErrUsedUp = errors.New("link has been used up")
+
+// Limited reports whether the link can only be followed MaxUses times
+func (s *ShortenedData) Limited() bool {
+	return s.MaxUses > 0
+}
+
+// UsedUp reports whether the link has been followed as many times as it is allowed to
+func (s *ShortenedData) UsedUp() bool {
+	return s.Limited() && s.Uses >= s.MaxUses
+}
+
+// Consume counts a use of a limited link, or returns ErrUsedUp if there is none left
+// it has to be called within persist.Persist.Update so that concurrent uses are all counted
+func (s *ShortenedData) Consume() error {
+	if s.UsedUp() {
+		return ErrUsedUp
+	}
+	if s.Limited() {
+		s.Uses++
+	}
+	return nil
+}
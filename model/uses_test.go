@@ -0,0 +1,48 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+func TestConsume(t *testing.T) {
+	unlimited, err := model.New("https://example.com/invite", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = unlimited.Consume(); err != nil {
+			t.Fatalf("links without max uses should never be used up, got: %v", err)
+		}
+	}
+
+	once, err := model.New("https://example.com/invite", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	once.MaxUses = 1
+	if err = once.MakeUnique(); err != nil {
+		t.Fatal(err)
+	}
+	if once.Hash == unlimited.Hash {
+		t.Fatalf("limited links should never share the hash of another link")
+	}
+
+	if !once.Limited() || once.UsedUp() {
+		t.Fatalf("a fresh one-time link should be limited but not used up")
+	}
+	if err = once.Consume(); err != nil {
+		t.Fatalf("the first use should be allowed, got: %v", err)
+	}
+	if !once.UsedUp() {
+		t.Fatalf("a one-time link should be used up after one use")
+	}
+	if err = once.Consume(); err != model.ErrUsedUp {
+		t.Fatalf("expecting ErrUsedUp, got: %v", err)
+	}
+	if once.Uses != 1 {
+		t.Fatalf("uses should stop at the limit, got: %d", once.Uses)
+	}
+}
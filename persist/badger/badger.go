@@ -3,68 +3,350 @@ package badger
 import (
 	"context"
 	"errors"
-	"github.com/alexadhy/shortener/internal/log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 
+	"github.com/alexadhy/shortener/config"
+	"github.com/alexadhy/shortener/internal/log"
 	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
 )
 
+func init() {
+	persist.Register("badger", func(opts config.Options) (persist.Persist, error) {
+		return New(opts.Badger.Path)
+	})
+}
+
 // Store implements persist.Persist
+// mu is held for writing by SetMany, so that Set can't take a key between its checks and its WriteBatch
 type Store struct {
 	db   *badger.DB
-	tiki time.Ticker
+	mu   *sync.RWMutex
+	tiki *time.Ticker
+	done chan struct{}
 }
 
+// Get the value of a shortened url, the entries are evicted by badger once their TTL is reached
+// expired entries still kept for their fallback URL are reported as persist.ErrExpired
 func (s Store) Get(_ context.Context, key string) (*model.ShortenedData, error) {
-	var sd model.ShortenedData
+	var sd *model.ShortenedData
 	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if err != nil {
-			return err
+		var err error
+		sd, err = get(txn, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sd.ExpiredAt(time.Now()) {
+		return sd, persist.ErrExpired
+	}
+	return sd, nil
+}
+
+func (s Store) Set(_ context.Context, data *model.ShortenedData) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err := s.db.Update(func(txn *badger.Txn) error {
+		existing, err := get(txn, data.Key)
+		if err == nil && !existing.ExpiredAt(time.Now()) {
+			return persist.CheckExisting(existing, data)
 		}
-		return item.Value(func(val []byte) error {
-			if _, err = sd.UnmarshalMsg(val); err != nil {
+		if err == nil {
+			// the counters of an expired link must not be inherited by the new one
+			if err = deleteClicks(txn, data.Key); err != nil {
 				return err
 			}
-			sd.Key = key
-			sd.Expiry = sd.Expiry.UTC()
-			return nil
-		})
+			return set(txn, data)
+		}
+		if errors.Is(err, persist.ErrNotFound) {
+			return set(txn, data)
+		}
+		return err
 	})
+	return err
+}
 
-	return &sd, err
+// SetMany checks every shortened url of data within a single read transaction, and writes the new ones with a WriteBatch
+func (s Store) SetMany(_ context.Context, data []*model.ShortenedData) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	errs := make([]error, len(data))
+	written := make(map[string]*model.ShortenedData, len(data))
+	var entries []*badger.Entry
+	var stale [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		for i, d := range data {
+			if w, ok := written[d.Key]; ok {
+				errs[i] = persist.CheckExisting(w, d)
+				continue
+			}
+
+			existing, err := get(txn, d.Key)
+			if err == nil && !existing.ExpiredAt(now) {
+				errs[i] = persist.CheckExisting(existing, d)
+				continue
+			}
+			if err != nil && !errors.Is(err, persist.ErrNotFound) {
+				return err
+			}
+
+			e, eerr := newEntry(d)
+			if eerr != nil {
+				errs[i] = eerr
+				continue
+			}
+			if err == nil {
+				// the counters of an expired link must not be inherited by the new one
+				stale = append(stale, clickKeys(txn, d.Key)...)
+			}
+			written[d.Key] = d
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, k := range stale {
+		if err = wb.Delete(k); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range entries {
+		if err = wb.SetEntry(e); err != nil {
+			return nil, err
+		}
+	}
+	if err = wb.Flush(); err != nil {
+		return nil, err
+	}
+	return errs, nil
 }
 
-func (s Store) Set(_ context.Context, data *model.ShortenedData) error {
-	err := s.db.Update(func(txn *badger.Txn) error {
-		_, err := txn.Get([]byte(data.Key))
-		if err == nil {
-			return nil
+// Delete removes the shortened url stored under key
+func (s Store) Delete(_ context.Context, key string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get([]byte(key)); err != nil {
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return persist.ErrNotFound
+			}
+			return err
+		}
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
 		}
-		if err != nil && errors.Is(err, badger.ErrKeyNotFound) {
-			exp := data.Expiry.Sub(time.Now().UTC())
-			b, err := data.MarshalMsg(nil)
+		return deleteClicks(txn, key)
+	})
+}
+
+// Update reads, modifies and writes back the shortened url stored under key in a single transaction
+// the transaction is retried when it conflicts with a concurrent write of the same key
+func (s Store) Update(ctx context.Context, key string, fn func(data *model.ShortenedData) error) (*model.ShortenedData, error) {
+	for attempt := 0; attempt < persist.MaxUpdateAttempts; attempt++ {
+		var sd *model.ShortenedData
+		err := s.db.Update(func(txn *badger.Txn) error {
+			var err error
+			sd, err = get(txn, key)
 			if err != nil {
 				return err
 			}
+			if sd.ExpiredAt(time.Now()) {
+				return persist.ErrNotFound
+			}
+			if err = fn(sd); err != nil {
+				return err
+			}
+			sd.Key = key
+			return set(txn, sd)
+		})
+		if errors.Is(err, badger.ErrConflict) {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return sd, nil
+	}
+	return nil, persist.ErrConflict
+}
+
+// List iterates the keys in lexicographical order, the cursor is the last key of the previous page
+func (s Store) List(_ context.Context, cursor string, limit int) ([]*model.ShortenedData, string, error) {
+	if limit <= 0 {
+		return nil, "", persist.ErrInvalidLimit
+	}
+
+	var res []*model.ShortenedData
+	var next string
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		now := time.Now()
+		it.Seek([]byte(cursor))
+		if cursor != "" && it.Valid() && string(it.Item().Key()) == cursor {
+			it.Next()
+		}
+
+		for ; it.Valid(); it.Next() {
+			if len(res) == limit {
+				next = res[len(res)-1].Key
+				return nil
+			}
 
-			if time.Now().After(data.Expiry) {
-				return errors.New("expiry is not valid")
+			item := it.Item()
+			if persist.IsInternalKey(string(item.Key())) {
+				continue
 			}
 
-			newEntry := badger.NewEntry([]byte(data.Key), b).WithTTL(exp)
-			return txn.SetEntry(newEntry)
+			var sd model.ShortenedData
+			err := item.Value(func(val []byte) error {
+				_, err := sd.UnmarshalMsg(val)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if sd.ExpiredAt(now) {
+				continue
+			}
+			sd.Key = string(item.KeyCopy(nil))
+			sd.UTC()
+			res = append(res, &sd)
 		}
-		return err
+		return nil
 	})
-	return err
+	if err != nil {
+		return nil, "", err
+	}
+	return res, next, nil
+}
+
+// get reads the shortened url stored under key within txn, expired or not
+func get(txn *badger.Txn, key string) (*model.ShortenedData, error) {
+	item, err := txn.Get([]byte(key))
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, persist.ErrNotFound
+		}
+		return nil, err
+	}
+
+	var sd model.ShortenedData
+	err = item.Value(func(val []byte) error {
+		if _, err := sd.UnmarshalMsg(val); err != nil {
+			return err
+		}
+		sd.Key = key
+		sd.UTC()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sd, nil
 }
 
-func (s Store) Expire(_ context.Context) (int, error) {
-	return 0, nil
+// set writes data within txn, the entry expires along with data
+func set(txn *badger.Txn, data *model.ShortenedData) error {
+	e, err := newEntry(data)
+	if err != nil {
+		return err
+	}
+	return txn.SetEntry(e)
+}
+
+// newEntry returns the entry data is written as, it expires along with data
+func newEntry(data *model.ShortenedData) (*badger.Entry, error) {
+	ttl, err := persist.TTL(data)
+	if err != nil {
+		return nil, err
+	}
+	b, err := data.MarshalMsg(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	e := badger.NewEntry([]byte(data.Key), b)
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+	return e, nil
+}
+
+// Expire walks every key and deletes the shortened urls which can be evicted, along with their click counters
+// badger already hides the entries past their TTL, this catches the ones whose expiry changed since they were written
+func (s Store) Expire(ctx context.Context) (int, error) {
+	now := time.Now()
+	var expired []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			if persist.IsInternalKey(string(item.Key())) {
+				continue
+			}
+
+			var sd model.ShortenedData
+			err := item.Value(func(val []byte) error {
+				_, err := sd.UnmarshalMsg(val)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if sd.EvictableAt(now) {
+				expired = append(expired, string(item.KeyCopy(nil)))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range expired {
+		// one transaction per key, the link may have been updated since the walk
+		deleted := false
+		err = s.db.Update(func(txn *badger.Txn) error {
+			sd, err := get(txn, key)
+			if err != nil || !sd.EvictableAt(now) {
+				return err
+			}
+			if err = txn.Delete([]byte(key)); err != nil {
+				return err
+			}
+			deleted = true
+			return deleteClicks(txn, key)
+		})
+		if err != nil && !errors.Is(err, persist.ErrNotFound) {
+			return n, err
+		}
+		if err == nil && deleted {
+			n++
+		}
+	}
+	return n, nil
 }
 
 // New takes a path to the new store and create a store
@@ -82,10 +364,15 @@ func New(pth string) (*Store, error) {
 		return nil, err
 	}
 
-	ticker := time.NewTicker(5 * time.Minute)
+	s := &Store{db: db, mu: &sync.RWMutex{}, tiki: time.NewTicker(5 * time.Minute), done: make(chan struct{})}
 
 	go func() {
-		for range ticker.C {
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-s.tiki.C:
+			}
 		again:
 			err := db.RunValueLogGC(0.7)
 			if err == nil {
@@ -94,10 +381,11 @@ func New(pth string) (*Store, error) {
 		}
 	}()
 
-	return &Store{db: db}, nil
+	return s, nil
 }
 
 func (s Store) Shutdown() error {
 	s.tiki.Stop()
+	close(s.done)
 	return s.db.Close()
 }
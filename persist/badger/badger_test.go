@@ -2,16 +2,19 @@ package badger_test
 
 import (
 	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
-	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	bd "github.com/dgraph-io/badger/v3"
-
 	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
 	"github.com/alexadhy/shortener/persist/badger"
+	"github.com/alexadhy/shortener/shortcode"
 )
 
 func seedDataToDB(t *testing.T, n int, store *badger.Store) []*model.ShortenedData {
@@ -28,8 +31,7 @@ func seedDataToDB(t *testing.T, n int, store *badger.Store) []*model.ShortenedDa
 }
 
 func bootstrapBadger(t *testing.T) *badger.Store {
-	wd, _ := os.Getwd()
-	fpath := filepath.Join(wd, "badger-test")
+	fpath := filepath.Join(t.TempDir(), "badger-test")
 
 	s, err := badger.New(fpath)
 	if err != nil {
@@ -59,7 +61,7 @@ func TestGet(t *testing.T) {
 			name:      "should return error if key doesn't exist",
 			input:     "aBCV3441",
 			want:      nil,
-			wantError: bd.ErrKeyNotFound,
+			wantError: persist.ErrNotFound,
 		},
 	}
 
@@ -126,3 +128,481 @@ func TestSet(t *testing.T) {
 		})
 	}
 }
+
+func TestSetExpiry(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+
+	fakeDatas, err := model.GenFake(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	neverExpires := *fakeDatas[1]
+	neverExpires.Expiry = time.Time{}
+
+	cases := []struct {
+		name  string
+		input *model.ShortenedData
+	}{
+		{
+			name:  "should keep the expiry of the data",
+			input: fakeDatas[0],
+		},
+		{
+			name:  "should be able to set data which never expires",
+			input: &neverExpires,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Nil(t, s.Set(context.Background(), tt.input))
+
+			got, err := s.Get(context.Background(), tt.input.Key)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.input.Expiry, got.Expiry)
+		})
+	}
+}
+
+func TestSetAlias(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+
+	existing, err := model.NewAlias("https://example.com/q3-report.pdf", "q3-report", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(context.Background(), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		orig      string
+		wantError error
+	}{
+		{
+			name:      "setting the same alias for the same url doesn't result in any error",
+			orig:      existing.Orig,
+			wantError: nil,
+		},
+		{
+			name:      "should not be able to take an alias used by another url",
+			orig:      "https://example.com/q4-report.pdf",
+			wantError: persist.ErrAliasTaken,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := model.NewAlias(tt.orig, existing.Short, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantError, s.Set(context.Background(), data))
+		})
+	}
+}
+
+func TestSaveCollision(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+
+	// every URL gets the same code on the first attempt
+	collidingGen := shortcode.GeneratorFunc(func(orig string, attempt int) (string, error) {
+		return "COLLIDE" + strconv.Itoa(attempt), nil
+	})
+
+	first, err := model.NewWithGenerator("https://example.com/first", time.Hour, collidingGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := model.NewWithGenerator("https://example.com/second", time.Hour, collidingGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, persist.Save(context.Background(), s, first, collidingGen))
+	assert.Equal(t, "COLLIDE0", first.Short)
+
+	assert.Equal(t, persist.ErrCollision, s.Set(context.Background(), second))
+	assert.Nil(t, persist.Save(context.Background(), s, second, collidingGen))
+	assert.Equal(t, "COLLIDE1", second.Short)
+
+	for _, want := range []*model.ShortenedData{first, second} {
+		got, err := s.Get(context.Background(), want.Short)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Orig, got.Orig)
+	}
+
+	// saving the second URL again ends up on the same alternate code
+	again, err := model.NewWithGenerator(second.Orig, time.Hour, collidingGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, persist.Save(context.Background(), s, again, collidingGen))
+	assert.Equal(t, second.Short, again.Short)
+}
+
+func TestDelete(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+	fakeDatas := seedDataToDB(t, 1, s)
+
+	cases := []struct {
+		name      string
+		input     string
+		wantError error
+	}{
+		{
+			name:      "should be able to delete existing data",
+			input:     fakeDatas[0].Key,
+			wantError: nil,
+		},
+		{
+			name:      "should return error if key doesn't exist anymore",
+			input:     fakeDatas[0].Key,
+			wantError: persist.ErrNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantError, s.Delete(context.Background(), tt.input))
+			_, err := s.Get(context.Background(), tt.input)
+			assert.Equal(t, persist.ErrNotFound, err)
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+	fakeDatas := seedDataToDB(t, 1, s)
+	errAbort := errors.New("abort")
+	newExpiry := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+
+	cases := []struct {
+		name      string
+		input     string
+		fn        func(data *model.ShortenedData) error
+		wantOrig  string
+		wantError error
+	}{
+		{
+			name:  "should be able to change destination and expiry",
+			input: fakeDatas[0].Key,
+			fn: func(data *model.ShortenedData) error {
+				data.Orig = "https://example.com/updated"
+				data.Expiry = newExpiry
+				return nil
+			},
+			wantOrig: "https://example.com/updated",
+		},
+		{
+			name:  "should not change anything if fn returns an error",
+			input: fakeDatas[0].Key,
+			fn: func(data *model.ShortenedData) error {
+				data.Orig = "https://example.com/aborted"
+				return errAbort
+			},
+			wantOrig:  "https://example.com/updated",
+			wantError: errAbort,
+		},
+		{
+			name:  "should return error if key doesn't exist",
+			input: "aBCV3441",
+			fn: func(data *model.ShortenedData) error {
+				return nil
+			},
+			wantError: persist.ErrNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Update(context.Background(), tt.input, tt.fn)
+			assert.Equal(t, tt.wantError, err)
+
+			if tt.wantOrig != "" {
+				got, err := s.Get(context.Background(), tt.input)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantOrig, got.Orig)
+				assert.True(t, newExpiry.Equal(got.Expiry))
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+	fakeDatas := seedDataToDB(t, 5, s)
+
+	seen := map[string]int{}
+	cursor := ""
+	pages := 0
+	for {
+		links, next, err := s.List(context.Background(), cursor, 2)
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, len(links), 2)
+		for _, l := range links {
+			seen[l.Key]++
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	assert.Greater(t, pages, 2)
+	for _, f := range fakeDatas {
+		assert.Equal(t, 1, seen[f.Key], "key %s should be listed exactly once", f.Key)
+	}
+
+	for _, limit := range []int{0, -1} {
+		_, _, err := s.List(context.Background(), "", limit)
+		assert.ErrorIs(t, err, persist.ErrInvalidLimit)
+	}
+}
+
+func TestClicks(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+	fakeDatas := seedDataToDB(t, 1, s)
+	key := fakeDatas[0].Key
+
+	hour := model.BucketStart(time.Now(), model.Hourly)
+	day := model.BucketStart(time.Now(), model.Daily)
+	counts := []model.ClickCount{
+		{Granularity: model.Hourly, Start: hour, Count: 2},
+		{Granularity: model.Daily, Start: day, Count: 2},
+	}
+	assert.Nil(t, s.IncrClicks(context.Background(), key, counts))
+	assert.Nil(t, s.IncrClicks(context.Background(), key, counts))
+
+	got, err := s.Clicks(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ClickCount{
+		{Granularity: model.Daily, Start: day, Count: 4},
+		{Granularity: model.Hourly, Start: hour, Count: 4},
+	}, got)
+
+	// counters are never listed as shortened urls
+	cursor := ""
+	for {
+		links, next, err := s.List(context.Background(), cursor, 100)
+		assert.Nil(t, err)
+		for _, l := range links {
+			assert.False(t, persist.IsInternalKey(l.Key))
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	// counters are removed along with the shortened url
+	assert.Nil(t, s.Delete(context.Background(), key))
+	got, err = s.Clicks(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Empty(t, got)
+}
+
+func TestExpire(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+	fakeDatas := seedDataToDB(t, 2, s)
+
+	expired := *fakeDatas[1]
+	expired.Expiry = time.Now().Add(-time.Minute).UTC()
+	assert.Nil(t, s.SetWithoutTTL(&expired))
+	assert.Nil(t, s.IncrClicks(context.Background(), expired.Key, []model.ClickCount{
+		{Granularity: model.Daily, Start: model.BucketStart(time.Now(), model.Daily), Count: 1},
+	}))
+
+	got, err := s.Get(context.Background(), expired.Key)
+	assert.Equal(t, persist.ErrExpired, err, "expired data should not be returned even before the sweep")
+	assert.Equal(t, expired.Orig, got.Orig)
+
+	links, _, err := s.List(context.Background(), "", 10)
+	assert.Nil(t, err)
+	assert.Len(t, links, 1)
+
+	n, err := s.Expire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = s.Expire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = s.Get(context.Background(), expired.Key)
+	assert.Equal(t, persist.ErrNotFound, err)
+	clicks, err := s.Clicks(context.Background(), expired.Key)
+	assert.Nil(t, err)
+	assert.Empty(t, clicks)
+
+	_, err = s.Get(context.Background(), fakeDatas[0].Key)
+	assert.Nil(t, err)
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+	sd, err := model.NewAlias("https://example.com/invite", "invite", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.MaxUses = 5
+	if err = s.Set(context.Background(), sd); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var consumed, usedUp int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Update(context.Background(), sd.Key, (*model.ShortenedData).Consume)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&consumed, 1)
+			case errors.Is(err, model.ErrUsedUp):
+				atomic.AddInt32(&usedUp, 1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), consumed)
+	assert.Equal(t, int32(15), usedUp)
+	got, err := s.Get(context.Background(), sd.Key)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, got.Uses)
+}
+
+func TestSetMany(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+
+	existing, err := model.NewAlias("https://example.com/q3-report.pdf", "q3-report", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(context.Background(), existing); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := model.NewAlias("https://example.com/old.pdf", "old-report", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired.Expiry = time.Now().Add(-time.Minute)
+	if err = s.SetWithoutTTL(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	newLink := func(orig, alias string, ttl time.Duration) *model.ShortenedData {
+		sd, err := model.NewAlias(orig, alias, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sd
+	}
+	past := newLink("https://example.com/past.pdf", "past-report", time.Hour)
+	past.Expiry = time.Now().Add(-time.Minute)
+
+	cases := []struct {
+		name      string
+		data      *model.ShortenedData
+		wantError error
+		wantOrig  string
+	}{
+		{
+			name:     "should write a new link",
+			data:     newLink("https://example.com/q4-report.pdf", "q4-report", time.Hour),
+			wantOrig: "https://example.com/q4-report.pdf",
+		},
+		{
+			name:     "setting an existing link again doesn't result in any error",
+			data:     newLink(existing.Orig, existing.Short, time.Hour),
+			wantOrig: existing.Orig,
+		},
+		{
+			name:      "should not be able to take an alias used by another url",
+			data:      newLink("https://example.com/other.pdf", existing.Short, time.Hour),
+			wantError: persist.ErrAliasTaken,
+			wantOrig:  existing.Orig,
+		},
+		{
+			name:      "should not be able to take an alias used earlier in the batch",
+			data:      newLink("https://example.com/other.pdf", "q4-report", time.Hour),
+			wantError: persist.ErrAliasTaken,
+			wantOrig:  "https://example.com/q4-report.pdf",
+		},
+		{
+			name:     "should replace an expired link",
+			data:     newLink("https://example.com/new.pdf", expired.Short, time.Hour),
+			wantOrig: "https://example.com/new.pdf",
+		},
+		{
+			name:      "should refuse a link which already expired",
+			data:      past,
+			wantError: persist.ErrInvalidExpiry,
+		},
+	}
+
+	data := make([]*model.ShortenedData, len(cases))
+	for i, tt := range cases {
+		data[i] = tt.data
+	}
+	errs, err := s.SetMany(context.Background(), data)
+	assert.Nil(t, err)
+
+	for i, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantError, errs[i])
+			got, err := s.Get(context.Background(), tt.data.Key)
+			if tt.wantOrig == "" {
+				assert.Equal(t, persist.ErrNotFound, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantOrig, got.Orig)
+		})
+	}
+}
+
+func TestSaveManyCollision(t *testing.T) {
+	s := bootstrapBadger(t)
+	defer s.Shutdown()
+
+	// every URL gets the same code on the first attempt
+	collidingGen := shortcode.GeneratorFunc(func(orig string, attempt int) (string, error) {
+		return "COLLIDE" + strconv.Itoa(attempt), nil
+	})
+
+	var data []*model.ShortenedData
+	for _, orig := range []string{"https://example.com/first", "https://example.com/second", "https://example.com/third"} {
+		sd, err := model.NewWithGenerator(orig, time.Hour, collidingGen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, sd)
+	}
+
+	errs, err := persist.SaveMany(context.Background(), s, data, collidingGen)
+	assert.Nil(t, err)
+	for i, want := range data {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, "COLLIDE"+strconv.Itoa(i), want.Short)
+		got, err := s.Get(context.Background(), want.Short)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Orig, got.Orig)
+	}
+}
@@ -0,0 +1,18 @@
+package badger
+
+import (
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+// SetWithoutTTL writes data as is, so that it outlives its expiry
+func (s Store) SetWithoutTTL(data *model.ShortenedData) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		b, err := data.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		return txn.Set([]byte(data.Key), b)
+	})
+}
@@ -0,0 +1,113 @@
+package badger
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+)
+
+// IncrClicks implements persist.StatsStore, every bucket is kept as its own big endian counter
+func (s Store) IncrClicks(_ context.Context, key string, counts []model.ClickCount) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		for _, c := range counts {
+			k := []byte(bucketKey(key, c.Granularity, c.Start))
+
+			var n uint64
+			item, err := txn.Get(k)
+			switch {
+			case err == nil:
+				err = item.Value(func(val []byte) error {
+					n = binary.BigEndian.Uint64(val)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			case !errors.Is(err, badger.ErrKeyNotFound):
+				return err
+			}
+
+			val := make([]byte, 8)
+			binary.BigEndian.PutUint64(val, n+uint64(c.Count))
+			retention := persist.StatsRetention(c.Granularity) - time.Since(c.Start)
+			if retention <= 0 {
+				continue
+			}
+			if err = txn.SetEntry(badger.NewEntry(k, val).WithTTL(retention)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Clicks implements persist.StatsStore
+func (s Store) Clicks(_ context.Context, key string) ([]model.ClickCount, error) {
+	var res []model.ClickCount
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, gran := range []string{model.Daily, model.Hourly} {
+			prefix := []byte(persist.StatsKey(key, gran) + ":")
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				unix, err := strconv.ParseInt(strings.TrimPrefix(string(item.Key()), string(prefix)), 10, 64)
+				if err != nil {
+					it.Close()
+					return err
+				}
+				var n uint64
+				err = item.Value(func(val []byte) error {
+					n = binary.BigEndian.Uint64(val)
+					return nil
+				})
+				if err != nil {
+					it.Close()
+					return err
+				}
+				res = append(res, model.ClickCount{Granularity: gran, Start: time.Unix(unix, 0).UTC(), Count: int64(n)})
+			}
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	persist.SortClicks(res)
+	return res, nil
+}
+
+// deleteClicks removes every click counter of key within txn
+func deleteClicks(txn *badger.Txn, key string) error {
+	for _, k := range clickKeys(txn, key) {
+		if err := txn.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clickKeys returns the keys of every click counter of key
+func clickKeys(txn *badger.Txn, key string) [][]byte {
+	var keys [][]byte
+	for _, gran := range []string{model.Daily, model.Hourly} {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte(persist.StatsKey(key, gran) + ":")})
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+	}
+	return keys
+}
+
+func bucketKey(key, granularity string, start time.Time) string {
+	return persist.StatsKey(key, granularity) + ":" + strconv.FormatInt(start.Unix(), 10)
+}
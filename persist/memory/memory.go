@@ -0,0 +1,250 @@
+// Package memory implements persist.Persist in memory, for tests and ephemeral deployments
+package memory
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexadhy/shortener/config"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+)
+
+const shardCount = 32
+
+func init() {
+	persist.Register("memory", func(_ config.Options) (persist.Persist, error) {
+		return New(), nil
+	})
+}
+
+type shard struct {
+	mu     sync.RWMutex
+	data   map[string]model.ShortenedData
+	clicks map[string]map[string]int64
+}
+
+// Store implements persist.Persist and persist.StatsStore
+// the keys are spread over shards, each guarded by its own lock
+type Store struct {
+	shards [shardCount]*shard
+	now    func() time.Time
+}
+
+// New creates an empty in-memory store
+func New() *Store {
+	s := &Store{now: time.Now}
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			data:   map[string]model.ShortenedData{},
+			clicks: map[string]map[string]int64{},
+		}
+	}
+	return s
+}
+
+func (s *Store) shard(key string) *shard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return s.shards[h.Sum32()%shardCount]
+}
+
+// expired reports whether sd has expired, the data is kept until the next Expire sweep
+// but it is treated as missing
+func (s *Store) expired(sd model.ShortenedData) bool {
+	return sd.ExpiredAt(s.now())
+}
+
+// Get the value of a shortened url, expired ones are reported as persist.ErrExpired until they are evicted
+func (s *Store) Get(_ context.Context, key string) (*model.ShortenedData, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	sd, ok := sh.data[key]
+	if !ok {
+		return nil, persist.ErrNotFound
+	}
+	sd.Key = key
+	if s.expired(sd) {
+		return &sd, persist.ErrExpired
+	}
+	return &sd, nil
+}
+
+// Set the value of a shortened url, while checking for duplicates
+func (s *Store) Set(_ context.Context, data *model.ShortenedData) error {
+	sh := s.shard(data.Key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if existing, ok := sh.data[data.Key]; ok && !s.expired(existing) {
+		return persist.CheckExisting(&existing, data)
+	}
+	if s.expired(*data) {
+		return persist.ErrInvalidExpiry
+	}
+
+	// the counters of an expired link must not be inherited by the new one
+	delete(sh.clicks, data.Key)
+	sh.data[data.Key] = *data
+	return nil
+}
+
+// SetMany sets every shortened url of data in turn
+func (s *Store) SetMany(ctx context.Context, data []*model.ShortenedData) ([]error, error) {
+	errs := make([]error, len(data))
+	for i, d := range data {
+		errs[i] = s.Set(ctx, d)
+	}
+	return errs, nil
+}
+
+// Delete removes the shortened url stored under key along with its click counters, even if it expired
+func (s *Store) Delete(_ context.Context, key string) error {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if _, ok := sh.data[key]; !ok {
+		return persist.ErrNotFound
+	}
+	delete(sh.data, key)
+	delete(sh.clicks, key)
+	return nil
+}
+
+// Update applies fn to a copy of the shortened url stored under key, and stores it if fn succeeds
+func (s *Store) Update(_ context.Context, key string, fn func(data *model.ShortenedData) error) (*model.ShortenedData, error) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sd, ok := sh.data[key]
+	if !ok || s.expired(sd) {
+		return nil, persist.ErrNotFound
+	}
+	sd.Key = key
+	if err := fn(&sd); err != nil {
+		return nil, err
+	}
+	if s.expired(sd) {
+		return nil, persist.ErrInvalidExpiry
+	}
+	sd.Key = key
+	sh.data[key] = sd
+	return &sd, nil
+}
+
+// List returns the shortened urls in lexicographical order of their keys, the cursor is the last key of the previous page
+func (s *Store) List(_ context.Context, cursor string, limit int) ([]*model.ShortenedData, string, error) {
+	if limit <= 0 {
+		return nil, "", persist.ErrInvalidLimit
+	}
+
+	var all []model.ShortenedData
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, sd := range sh.data {
+			if k > cursor && !s.expired(sd) {
+				sd.Key = k
+				all = append(all, sd)
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+
+	var next string
+	if len(all) > limit {
+		all = all[:limit]
+		next = all[limit-1].Key
+	}
+
+	res := make([]*model.ShortenedData, len(all))
+	for i := range all {
+		res[i] = &all[i]
+	}
+	return res, next, nil
+}
+
+// Expire evicts the expired shortened urls along with their click counters, and returns how many were evicted
+// the ones with a fallback URL are kept for model.FallbackRetention
+func (s *Store) Expire(_ context.Context) (int, error) {
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for k, sd := range sh.data {
+			if sd.EvictableAt(s.now()) {
+				delete(sh.data, k)
+				delete(sh.clicks, k)
+				n++
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return n, nil
+}
+
+// Shutdown doesn't do anything, the data is simply lost
+func (s *Store) Shutdown() error {
+	return nil
+}
+
+// IncrClicks implements persist.StatsStore, the buckets of key older than the retention are deleted along
+func (s *Store) IncrClicks(_ context.Context, key string, counts []model.ClickCount) error {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if _, ok := sh.clicks[key]; !ok {
+		sh.clicks[key] = map[string]int64{}
+	}
+	for k := range sh.clicks[key] {
+		if s.stale(k) {
+			delete(sh.clicks[key], k)
+		}
+	}
+	for _, c := range counts {
+		sh.clicks[key][bucketKey(c)] += c.Count
+	}
+	return nil
+}
+
+// Clicks implements persist.StatsStore, buckets older than the retention are filtered out
+func (s *Store) Clicks(_ context.Context, key string) ([]model.ClickCount, error) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	var res []model.ClickCount
+	for k, n := range sh.clicks[key] {
+		if s.stale(k) {
+			continue
+		}
+		gran, start := parseBucketKey(k)
+		res = append(res, model.ClickCount{Granularity: gran, Start: start, Count: n})
+	}
+	persist.SortClicks(res)
+	return res, nil
+}
+
+// stale reports whether the bucket k is older than the retention of its granularity
+func (s *Store) stale(k string) bool {
+	gran, start := parseBucketKey(k)
+	return s.now().Sub(start) > persist.StatsRetention(gran)
+}
+
+func bucketKey(c model.ClickCount) string {
+	return c.Granularity + ":" + c.Start.UTC().Format(time.RFC3339)
+}
+
+func parseBucketKey(k string) (string, time.Time) {
+	i := strings.IndexByte(k, ':')
+	start, _ := time.Parse(time.RFC3339, k[i+1:])
+	return k[:i], start.UTC()
+}
@@ -0,0 +1,269 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+)
+
+func seedDataToStore(t *testing.T, n int, store *Store) []*model.ShortenedData {
+	fakeData, err := model.GenFake(n)
+	if err != nil {
+		t.Fatalf("seedDataToStore(): %v", err)
+	}
+	for _, f := range fakeData {
+		if err = store.Set(context.Background(), f); err != nil {
+			t.Fatalf("seedDataToStore() Set: %v", err)
+		}
+	}
+	return fakeData
+}
+
+func TestGet(t *testing.T) {
+	s := New()
+	fakeDatas := seedDataToStore(t, 3, s)
+
+	cases := []struct {
+		name      string
+		input     string
+		want      *model.ShortenedData
+		wantError error
+	}{
+		{
+			name:  "should be able to correctly get data if key is valid",
+			input: fakeDatas[0].Key,
+			want:  fakeDatas[0],
+		},
+		{
+			name:      "should return error if key doesn't exist",
+			input:     "aBCV3441",
+			wantError: persist.ErrNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Get(context.Background(), tt.input)
+			assert.Equal(t, tt.wantError, err)
+			if tt.want != nil {
+				assert.Equal(t, *tt.want, *got)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	s := New()
+	existing := seedDataToStore(t, 1, s)[0]
+
+	alias, err := model.NewAlias("https://example.com/other", existing.Key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := *existing
+	expired.Key, expired.Short = "EXPIRED0", "EXPIRED0"
+	expired.Expiry = time.Now().Add(-time.Minute)
+
+	cases := []struct {
+		name      string
+		input     *model.ShortenedData
+		wantError error
+		hasErr    bool
+	}{
+		{
+			name:  "trying to input the same data twice doesn't result in any error",
+			input: existing,
+		},
+		{
+			name:      "should not be able to take an alias used by another url",
+			input:     alias,
+			wantError: persist.ErrAliasTaken,
+			hasErr:    true,
+		},
+		{
+			name:   "should not be able to set data if expiry is wrong",
+			input:  &expired,
+			hasErr: true,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Set(context.Background(), tt.input)
+			if !tt.hasErr {
+				assert.Nil(t, err)
+				return
+			}
+			assert.NotNil(t, err)
+			if tt.wantError != nil {
+				assert.Equal(t, tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	s := New()
+	existing := seedDataToStore(t, 1, s)[0]
+
+	got, err := s.Update(context.Background(), existing.Key, func(data *model.ShortenedData) error {
+		data.Orig = "https://example.com/updated"
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/updated", got.Orig)
+
+	// the returned value is a copy
+	got.Orig = "https://example.com/mutated"
+	stored, err := s.Get(context.Background(), existing.Key)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/updated", stored.Orig)
+
+	assert.Nil(t, s.Delete(context.Background(), existing.Key))
+	assert.Equal(t, persist.ErrNotFound, s.Delete(context.Background(), existing.Key))
+	_, err = s.Update(context.Background(), existing.Key, func(data *model.ShortenedData) error { return nil })
+	assert.Equal(t, persist.ErrNotFound, err)
+}
+
+func TestList(t *testing.T) {
+	s := New()
+	fakeDatas := seedDataToStore(t, 5, s)
+
+	seen := map[string]int{}
+	cursor := ""
+	pages := 0
+	for {
+		links, next, err := s.List(context.Background(), cursor, 2)
+		assert.Nil(t, err)
+		for _, l := range links {
+			seen[l.Key]++
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Len(t, seen, len(fakeDatas))
+	for _, f := range fakeDatas {
+		assert.Equal(t, 1, seen[f.Key])
+	}
+
+	for _, limit := range []int{0, -1} {
+		_, _, err := s.List(context.Background(), "", limit)
+		assert.ErrorIs(t, err, persist.ErrInvalidLimit)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	s := New()
+	fakeDatas := seedDataToStore(t, 3, s)
+
+	// one of them is long lived
+	_, err := s.Update(context.Background(), fakeDatas[0].Key, func(data *model.ShortenedData) error {
+		data.Expiry = time.Now().Add(24 * time.Hour)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// fake data expire after 10 minutes
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	_, err = s.Get(context.Background(), fakeDatas[1].Key)
+	assert.Equal(t, persist.ErrExpired, err, "expired data should not be returned even before the sweep")
+
+	n, err := s.Expire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = s.Expire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = s.Get(context.Background(), fakeDatas[0].Key)
+	assert.Nil(t, err)
+}
+
+func TestDeleteExpired(t *testing.T) {
+	s := New()
+	fakeDatas := seedDataToStore(t, 1, s)
+	assert.Nil(t, s.IncrClicks(context.Background(), fakeDatas[0].Key, []model.ClickCount{
+		{Granularity: model.Daily, Start: model.BucketStart(time.Now(), model.Daily), Count: 1},
+	}))
+
+	// fake data expire after 10 minutes
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+
+	assert.Nil(t, s.Delete(context.Background(), fakeDatas[0].Key))
+	_, err := s.Get(context.Background(), fakeDatas[0].Key)
+	assert.Equal(t, persist.ErrNotFound, err)
+	clicks, err := s.Clicks(context.Background(), fakeDatas[0].Key)
+	assert.Nil(t, err)
+	assert.Empty(t, clicks)
+
+	n, err := s.Expire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestClicks(t *testing.T) {
+	s := New()
+	key := seedDataToStore(t, 1, s)[0].Key
+
+	hour := model.BucketStart(time.Now(), model.Hourly)
+	day := model.BucketStart(time.Now(), model.Daily)
+	counts := []model.ClickCount{
+		{Granularity: model.Hourly, Start: hour, Count: 2},
+		{Granularity: model.Daily, Start: day, Count: 2},
+	}
+	assert.Nil(t, s.IncrClicks(context.Background(), key, counts))
+
+	// once past its retention, the hourly bucket is deleted on the next click rather than only hidden
+	s.now = func() time.Time { return time.Now().Add(24*time.Hour + persist.HourlyStatsRetention) }
+	later := []model.ClickCount{{Granularity: model.Hourly, Start: model.BucketStart(s.now(), model.Hourly), Count: 1}}
+	assert.Nil(t, s.IncrClicks(context.Background(), key, later))
+
+	got, err := s.Clicks(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ClickCount{
+		{Granularity: model.Daily, Start: day, Count: 2},
+		{Granularity: model.Hourly, Start: later[0].Start, Count: 1},
+	}, got)
+	assert.Len(t, s.shard(key).clicks[key], 2)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	s := New()
+	fakeDatas := seedDataToStore(t, 100, s)
+
+	var wg sync.WaitGroup
+	for _, f := range fakeDatas {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				_, _ = s.Update(context.Background(), key, func(data *model.ShortenedData) error {
+					data.Orig += "x"
+					return nil
+				})
+				_, _ = s.Get(context.Background(), key)
+				_ = s.IncrClicks(context.Background(), key, []model.ClickCount{{Granularity: model.Hourly, Start: time.Now(), Count: 1}})
+			}
+		}(f.Key)
+	}
+	wg.Wait()
+
+	for _, f := range fakeDatas {
+		got, err := s.Get(context.Background(), f.Key)
+		assert.Nil(t, err)
+		assert.Equal(t, f.Orig+"xxxxxxxxxx", got.Orig)
+	}
+}
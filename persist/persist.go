@@ -2,18 +2,189 @@ package persist
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/shortcode"
 )
 
+var (
+	// ErrAliasTaken is returned by Set when a custom alias is already used by another URL
+	ErrAliasTaken = errors.New("alias is already taken")
+	// ErrCollision is returned by Set when the short code derived for a URL is already used by another URL
+	ErrCollision = errors.New("short code is already used by another URL")
+	// ErrNotFound is returned by Get, Delete and Update when there is no shortened url stored under the key
+	ErrNotFound = errors.New("shortened url not found")
+	// ErrExpired is returned by Get, along with the data, when the shortened url expired but wasn't evicted yet
+	ErrExpired = errors.New("shortened url expired")
+	// ErrInvalidExpiry is returned by Set and Update when the expiry of the shortened url already passed
+	ErrInvalidExpiry = errors.New("expiry is not valid")
+	// ErrConflict is returned by Update, or Set, when it kept conflicting with concurrent writes for MaxUpdateAttempts
+	ErrConflict = errors.New("too many concurrent updates")
+	// ErrInvalidLimit is returned by List when the page size isn't positive
+	ErrInvalidLimit = errors.New("limit has to be positive")
+)
+
+// MaxUpdateAttempts is how many times Update runs a transaction conflicting with concurrent writes before giving up
+const MaxUpdateAttempts = 64
+
 // Persist is the common interface to all of the storage type that interact with *model.ShortenedData
 type Persist interface {
 	// Get the value of a shortened url from the persistence layer
+	// it returns ErrNotFound if there is nothing stored under key, and ErrExpired if the shortened url expired
 	Get(ctx context.Context, key string) (*model.ShortenedData, error)
 	// Set the value of a shortened url to the persistence layer, while checking for duplicates
+	// it returns ErrAliasTaken if data is a custom alias already pointing to a different URL
+	// and ErrCollision if the short code already points to a different URL
 	Set(ctx context.Context, data *model.ShortenedData) error
-	// Expire will evict the data of a shortened url from the persistence layer
+	// SetMany sets every shortened url of data like Set would, in as few round trips as the persistence layer allows
+	// the returned errors are those Set would have returned for the item of data at the same index,
+	// the error is only returned when the batch couldn't be written at all
+	SetMany(ctx context.Context, data []*model.ShortenedData) ([]error, error)
+	// Delete removes a shortened url from the persistence layer, an expired one which wasn't evicted yet included
+	// it returns ErrNotFound if there is nothing stored under key
+	Delete(ctx context.Context, key string) error
+	// Update atomically applies fn to the shortened url stored under key and persists the result
+	// fn may be called again if the shortened url was modified concurrently, so it must not have side effects
+	// it returns ErrNotFound if there is nothing stored under key or if it expired, or the error returned by fn
+	Update(ctx context.Context, key string, fn func(data *model.ShortenedData) error) (*model.ShortenedData, error)
+	// List returns up to limit shortened urls stored after cursor, ordered the way the persistence layer iterates them
+	// the returned cursor is passed to the next call to get the next page, it is empty once everything has been listed
+	// it returns ErrInvalidLimit if limit isn't positive
+	List(ctx context.Context, cursor string, limit int) ([]*model.ShortenedData, string, error)
+	// Expire evicts the expired shortened urls from the persistence layer and returns how many were evicted
 	Expire(ctx context.Context) (int, error)
 	// Shutdown clean up connection
 	Shutdown() error
 }
+
+// TTL returns how long a persistence layer has to keep data, 0 means forever
+// it returns ErrInvalidExpiry if data already expired
+func TTL(data *model.ShortenedData) (time.Duration, error) {
+	if data.ExpiredAt(time.Now()) {
+		return 0, ErrInvalidExpiry
+	}
+	evictAt := data.EvictAt()
+	if evictAt.IsZero() {
+		return 0, nil
+	}
+	return time.Until(evictAt), nil
+}
+
+const (
+	// HourlyStatsRetention is how long hourly click counters are kept
+	HourlyStatsRetention = 14 * 24 * time.Hour
+	// DailyStatsRetention is how long daily click counters are kept
+	DailyStatsRetention = 400 * 24 * time.Hour
+
+	// internalPrefix is prepended to the keys that don't hold a shortened url,
+	// it can't be part of a short code so they never clash
+	internalPrefix = "!"
+)
+
+// StatsStore is implemented by the persistence layers able to keep click counters of shortened urls
+type StatsStore interface {
+	// IncrClicks adds the counts to the click counters of key
+	IncrClicks(ctx context.Context, key string, counts []model.ClickCount) error
+	// Clicks returns all the retained click counters of key, sorted by granularity and start
+	Clicks(ctx context.Context, key string) ([]model.ClickCount, error)
+}
+
+// StatsKey returns the key under which the click counters of key with the given granularity are kept
+// the key is wrapped in a redis hash tag so the counters live in the same cluster slot as the shortened url
+func StatsKey(key, granularity string) string {
+	return internalPrefix + "stats:{" + key + "}:" + granularity
+}
+
+// StatsRetention returns how long the click counters of the given granularity are kept
+func StatsRetention(granularity string) time.Duration {
+	if granularity == model.Daily {
+		return DailyStatsRetention
+	}
+	return HourlyStatsRetention
+}
+
+// IsInternalKey reports whether key holds internal data rather than a shortened url
+func IsInternalKey(key string) bool {
+	return strings.HasPrefix(key, internalPrefix)
+}
+
+// SortClicks sorts click counters by granularity and start
+func SortClicks(counts []model.ClickCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Granularity != counts[j].Granularity {
+			return counts[i].Granularity < counts[j].Granularity
+		}
+		return counts[i].Start.Before(counts[j].Start)
+	})
+}
+
+// CheckExisting is used by Set implementations when a record already exists under data.Key
+// it returns nil if existing is the same URL, so Set can be a no-op, ErrAliasTaken or ErrCollision otherwise
+func CheckExisting(existing, data *model.ShortenedData) error {
+	switch {
+	case existing.Hash == data.Hash:
+		return nil
+	case data.Custom:
+		return ErrAliasTaken
+	default:
+		return ErrCollision
+	}
+}
+
+// MaxAttempts is the number of short codes Save tries before giving up on a collision
+const MaxAttempts = 16
+
+// Save sets data to p, and on collision regenerates the short code with g until a free one is found
+// data.Key and data.Short are updated to the code the URL is stored under
+func Save(ctx context.Context, p Persist, data *model.ShortenedData, g shortcode.Generator) error {
+	for attempt := 1; ; attempt++ {
+		err := p.Set(ctx, data)
+		if !errors.Is(err, ErrCollision) || attempt >= MaxAttempts {
+			return err
+		}
+		if rerr := data.Regenerate(g, attempt); rerr != nil {
+			return fmt.Errorf("%w: %v", err, rerr)
+		}
+	}
+}
+
+// SaveMany is Save for every item of data, the items colliding with a different URL are retried together with SetMany
+// the returned errors are those of the item of data at the same index
+func SaveMany(ctx context.Context, p Persist, data []*model.ShortenedData, g shortcode.Generator) ([]error, error) {
+	errs := make([]error, len(data))
+	pending := make([]int, len(data))
+	for i := range pending {
+		pending[i] = i
+	}
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		batch := make([]*model.ShortenedData, len(pending))
+		for j, i := range pending {
+			batch[j] = data[i]
+		}
+		res, err := p.SetMany(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		for j, i := range pending {
+			errs[i] = res[j]
+			if !errors.Is(res[j], ErrCollision) || attempt >= MaxAttempts {
+				continue
+			}
+			if rerr := data[i].Regenerate(g, attempt); rerr != nil {
+				errs[i] = fmt.Errorf("%w: %v", res[j], rerr)
+				continue
+			}
+			retry = append(retry, i)
+		}
+		pending = retry
+	}
+	return errs, nil
+}
@@ -2,13 +2,27 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
+	"github.com/alexadhy/shortener/config"
 	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
 )
 
+func init() {
+	persist.Register("redis", func(opts config.Options) (persist.Persist, error) {
+		return New(opts.Redis.Addresses...)
+	})
+}
+
+// errKeyTaken is returned by set when the key was taken between the check and the write, the check is then run again
+var errKeyTaken = errors.New("key taken concurrently")
+
 // Store implements persist.Persist
 type Store struct {
 	rc redis.UniversalClient
@@ -18,6 +32,9 @@ type Store struct {
 func (s *Store) Get(ctx context.Context, key string) (*model.ShortenedData, error) {
 	val, err := s.rc.Get(ctx, key).Result()
 	if err != nil {
+		if err == redis.Nil {
+			return nil, persist.ErrNotFound
+		}
 		return nil, err
 	}
 	var m model.ShortenedData
@@ -25,27 +42,246 @@ func (s *Store) Get(ctx context.Context, key string) (*model.ShortenedData, erro
 		return nil, err
 	}
 	m.Key = key
-	m.Expiry = m.Expiry.UTC()
+	m.UTC()
+	if m.ExpiredAt(time.Now()) {
+		// redis did not evict it yet, or the expiry changed since it was written
+		return &m, persist.ErrExpired
+	}
 	return &m, nil
 }
 
 // Set the value of a shortened url to redis, while checking for duplicates
+// the check runs again whenever the key gets taken before the write, up to persist.MaxUpdateAttempts times
 func (s *Store) Set(ctx context.Context, data *model.ShortenedData) error {
-	_, err := s.Get(ctx, data.Key)
-	if err == redis.Nil {
-		exp := data.Expiry.Sub(time.Now().UTC())
+	for attempt := 0; attempt < persist.MaxUpdateAttempts; attempt++ {
+		err := s.set(ctx, data)
+		if err == errKeyTaken {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			continue
+		}
+		return err
+	}
+	return persist.ErrConflict
+}
+
+func (s *Store) set(ctx context.Context, data *model.ShortenedData) error {
+	existing, err := s.Get(ctx, data.Key)
+	if err == nil {
+		return persist.CheckExisting(existing, data)
+	}
+	if errors.Is(err, persist.ErrExpired) {
+		// remove it along with its click counters, SETNX would fail otherwise
+		if err = s.Delete(ctx, data.Key); err != nil && !errors.Is(err, persist.ErrNotFound) {
+			return err
+		}
+		err = persist.ErrNotFound
+	}
+	if errors.Is(err, persist.ErrNotFound) {
+		// a ttl of 0 stores the key without expiration
+		ttl, err := persist.TTL(data)
+		if err != nil {
+			return err
+		}
 		b, err := data.MarshalMsg(nil)
 		if err != nil {
 			return err
 		}
-		if err = s.rc.SetEX(ctx, data.Key, b, exp).Err(); err != nil {
+		ok, err := s.rc.SetNX(ctx, data.Key, b, ttl).Result()
+		if err != nil {
 			return err
 		}
+		if !ok {
+			// someone else took the key in between, compare against what they stored
+			return errKeyTaken
+		}
+		return nil
+	}
+	return err
+}
+
+// SetMany pipelines a SETNX for every shortened url of data
+// the keys which are already taken, possibly by an earlier item of data, go through Set to be checked for duplicates
+func (s *Store) SetMany(ctx context.Context, data []*model.ShortenedData) ([]error, error) {
+	errs := make([]error, len(data))
+	cmds := make([]*redis.BoolCmd, len(data))
+	_, err := s.rc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, d := range data {
+			ttl, err := persist.TTL(d)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			b, err := d.MarshalMsg(nil)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			cmds[i] = pipe.SetNX(ctx, d.Key, b, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cmd := range cmds {
+		if cmd != nil && !cmd.Val() {
+			errs[i] = s.Set(ctx, data[i])
+		}
+	}
+	return errs, nil
+}
+
+// Delete removes the shortened url stored under key from redis
+func (s *Store) Delete(ctx context.Context, key string) error {
+	n, err := s.rc.Del(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return persist.ErrNotFound
+	}
+	// the click counters share the hash slot of the key, so they can be removed in a single command
+	return s.rc.Del(ctx, persist.StatsKey(key, model.Daily), persist.StatsKey(key, model.Hourly)).Err()
+}
+
+// Update reads, modifies and writes back the shortened url stored under key
+// the key is WATCHed so the write fails with redis.TxFailedErr if it was modified concurrently, it is then retried
+func (s *Store) Update(ctx context.Context, key string, fn func(data *model.ShortenedData) error) (*model.ShortenedData, error) {
+	for attempt := 0; attempt < persist.MaxUpdateAttempts; attempt++ {
+		sd, err := s.update(ctx, key, fn)
+		if err == redis.TxFailedErr {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return sd, err
+	}
+	return nil, persist.ErrConflict
+}
+
+func (s *Store) update(ctx context.Context, key string, fn func(data *model.ShortenedData) error) (*model.ShortenedData, error) {
+	var sd *model.ShortenedData
+	err := s.rc.Watch(ctx, func(tx *redis.Tx) error {
+		val, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return persist.ErrNotFound
+			}
+			return err
+		}
+
+		sd = &model.ShortenedData{}
+		if _, err = sd.UnmarshalMsg(val); err != nil {
+			return err
+		}
+		sd.Key = key
+		sd.UTC()
+		if sd.ExpiredAt(time.Now()) {
+			return persist.ErrNotFound
+		}
+		if err = fn(sd); err != nil {
+			return err
+		}
+
+		ttl, err := persist.TTL(sd)
+		if err != nil {
+			return err
+		}
+		b, err := sd.MarshalMsg(nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			return pipe.Set(ctx, key, b, ttl).Err()
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
+
+// List uses SCAN to iterate the keys, the cursor is the one returned by redis
+// limit is only passed as a hint to SCAN, so a page may contain more or less than limit items
+// on a redis cluster SCAN only walks the node serving the command
+func (s *Store) List(ctx context.Context, cursor string, limit int) ([]*model.ShortenedData, string, error) {
+	if limit <= 0 {
+		return nil, "", persist.ErrInvalidLimit
+	}
+
+	var c uint64
+	if cursor != "" {
+		var err error
+		if c, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q: %w", cursor, err)
+		}
+	}
+
+	keys, c, err := s.rc.Scan(ctx, c, "*", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	links := keys[:0]
+	for _, k := range keys {
+		if !persist.IsInternalKey(k) {
+			links = append(links, k)
+		}
+	}
+	keys = links
+
+	var next string
+	if c != 0 {
+		next = strconv.FormatUint(c, 10)
+	}
+	if len(keys) == 0 {
+		return nil, next, nil
+	}
+
+	// pipelined GETs rather than MGET, so it works when keys live in different cluster slots
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err = s.rc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, k := range keys {
+			cmds[i] = pipe.Get(ctx, k)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	res := make([]*model.ShortenedData, 0, len(keys))
+	for i, cmd := range cmds {
+		val, err := cmd.Bytes()
+		if err == redis.Nil {
+			// expired or deleted since the SCAN
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		var m model.ShortenedData
+		if _, err = m.UnmarshalMsg(val); err != nil {
+			return nil, "", err
+		}
+		if m.ExpiredAt(now) {
+			continue
+		}
+		m.Key = keys[i]
+		m.UTC()
+		res = append(res, &m)
 	}
-	return nil
+	return res, next, nil
 }
 
-// Expire will not do anything on redis since we set the expiry from redis.SetEX
+// Expire will not do anything on redis since the keys are written with a TTL matching their expiry
+// and Get already refuses the expired ones
 func (s *Store) Expire(_ context.Context) (int, error) {
 	return 0, nil
 }
@@ -64,6 +300,7 @@ func New(addresses ...string) (*Store, error) {
 	return &Store{rc}, nil
 }
 
+// NewTest creates a *Store on top of an existing client, e.g. one connected to miniredis
 func NewTest(rdb redis.UniversalClient) *Store {
 	return &Store{rc: rdb}
 }
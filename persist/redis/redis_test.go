@@ -0,0 +1,602 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/persist/redis"
+	"github.com/alexadhy/shortener/shortcode"
+)
+
+func seedDataToDB(t *testing.T, n int, store *redis.Store) []*model.ShortenedData {
+	fakeData, err := model.GenFake(n)
+	if err != nil {
+		t.Fatalf("seedDataToDB(): %v", err)
+	}
+	for _, f := range fakeData {
+		if err = store.Set(context.Background(), f); err != nil {
+			t.Fatalf("seedDataToDB() Set: %v", err)
+		}
+	}
+	return fakeData
+}
+
+func bootstrapRedis(t *testing.T) (*redis.Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	s := redis.NewTest(goredis.NewClient(&goredis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() {
+		_ = s.Shutdown()
+	})
+	return s, mr
+}
+
+func TestGet(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+	fakeDatas := seedDataToDB(t, 3, s)
+
+	cases := []struct {
+		name      string
+		input     string
+		want      *model.ShortenedData
+		wantError error
+	}{
+		{
+			name:      "should be able to correctly get data if key is valid",
+			input:     fakeDatas[0].Key,
+			want:      fakeDatas[0],
+			wantError: nil,
+		},
+		{
+			name:      "should return error if key doesn't exist",
+			input:     "aBCV3441",
+			want:      nil,
+			wantError: persist.ErrNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Get(context.TODO(), tt.input)
+			assert.Equal(t, tt.wantError, err)
+
+			if tt.want != nil {
+				assert.Equal(t, *tt.want, *got)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	s, mr := bootstrapRedis(t)
+	existingData := seedDataToDB(t, 1, s)
+
+	fakeDatas, err := model.GenFake(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		input   *model.ShortenedData
+		hasErr  bool
+		wantTTL bool
+	}{
+		{
+			name:    "should be able to correctly set data if data is valid",
+			input:   fakeDatas[0],
+			wantTTL: true,
+		},
+		{
+			name: "should not be able to set data if expiry is wrong",
+			input: &model.ShortenedData{
+				Key:    fakeDatas[1].Key,
+				Hash:   fakeDatas[1].Hash,
+				Short:  fakeDatas[1].Short,
+				Orig:   fakeDatas[1].Orig,
+				Expiry: time.Now().AddDate(0, 0, -1).UTC(),
+			},
+			hasErr: true,
+		},
+		{
+			name:    "trying to input the same data twice doesn't result in any error",
+			input:   existingData[0],
+			wantTTL: true,
+		},
+		{
+			name: "should be able to set data which never expires",
+			input: &model.ShortenedData{
+				Key:   fakeDatas[2].Key,
+				Hash:  fakeDatas[2].Hash,
+				Short: fakeDatas[2].Short,
+				Orig:  fakeDatas[2].Orig,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Set(context.Background(), tt.input)
+			if tt.hasErr {
+				assert.NotNil(t, err)
+				assert.False(t, mr.Exists(tt.input.Key))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantTTL, mr.TTL(tt.input.Key) > 0)
+		})
+	}
+}
+
+func TestSetExpired(t *testing.T) {
+	s, mr := bootstrapRedis(t)
+
+	expired, err := model.NewAlias("https://example.com/old.pdf", "old-report", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, s.Set(context.Background(), expired))
+	assert.Nil(t, s.IncrClicks(context.Background(), expired.Key, []model.ClickCount{
+		{Granularity: model.Daily, Start: model.BucketStart(time.Now(), model.Daily), Count: 1},
+	}))
+
+	// the expiry changed since the key was written, redis still holds it
+	_, err = s.Update(context.Background(), expired.Key, func(data *model.ShortenedData) error {
+		data.Expiry = time.Now().Add(time.Second)
+		return nil
+	})
+	assert.Nil(t, err)
+	mr.SetTTL(expired.Key, time.Hour)
+	time.Sleep(1100 * time.Millisecond)
+
+	got, err := s.Get(context.Background(), expired.Key)
+	assert.Equal(t, persist.ErrExpired, err)
+	assert.Equal(t, expired.Orig, got.Orig)
+
+	// the alias can be taken again, without the clicks of the previous link
+	replacement, err := model.NewAlias("https://example.com/new.pdf", expired.Short, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, s.Set(context.Background(), replacement))
+	got, err = s.Get(context.Background(), expired.Key)
+	assert.Nil(t, err)
+	assert.Equal(t, replacement.Orig, got.Orig)
+	assert.False(t, mr.Exists(persist.StatsKey(expired.Key, model.Daily)))
+}
+
+func TestSetAlias(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+
+	existing, err := model.NewAlias("https://example.com/q3-report.pdf", "q3-report", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(context.Background(), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		orig      string
+		wantError error
+	}{
+		{
+			name:      "setting the same alias for the same url doesn't result in any error",
+			orig:      existing.Orig,
+			wantError: nil,
+		},
+		{
+			name:      "should not be able to take an alias used by another url",
+			orig:      "https://example.com/q4-report.pdf",
+			wantError: persist.ErrAliasTaken,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := model.NewAlias(tt.orig, existing.Short, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantError, s.Set(context.Background(), data))
+		})
+	}
+}
+
+func TestSaveCollision(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+
+	// every URL gets the same code on the first attempt
+	collidingGen := shortcode.GeneratorFunc(func(orig string, attempt int) (string, error) {
+		return "COLLIDE" + strconv.Itoa(attempt), nil
+	})
+
+	first, err := model.NewWithGenerator("https://example.com/first", time.Hour, collidingGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := model.NewWithGenerator("https://example.com/second", time.Hour, collidingGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(t, persist.Save(context.Background(), s, first, collidingGen))
+	assert.Equal(t, "COLLIDE0", first.Short)
+
+	assert.Equal(t, persist.ErrCollision, s.Set(context.Background(), second))
+	assert.Nil(t, persist.Save(context.Background(), s, second, collidingGen))
+	assert.Equal(t, "COLLIDE1", second.Short)
+
+	for _, want := range []*model.ShortenedData{first, second} {
+		got, err := s.Get(context.Background(), want.Short)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Orig, got.Orig)
+	}
+
+	// saving the second URL again ends up on the same alternate code
+	again, err := model.NewWithGenerator(second.Orig, time.Hour, collidingGen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, persist.Save(context.Background(), s, again, collidingGen))
+	assert.Equal(t, second.Short, again.Short)
+}
+
+func TestSetConcurrent(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+
+	var wg sync.WaitGroup
+	var saved, taken int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sd, err := model.NewAlias("https://example.com/"+strconv.Itoa(i%2), "race", time.Hour)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			err = s.Set(context.Background(), sd)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&saved, 1)
+			case errors.Is(err, persist.ErrAliasTaken):
+				atomic.AddInt32(&taken, 1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// only the url which won the race can set the alias again
+	assert.Equal(t, int32(10), saved)
+	assert.Equal(t, int32(10), taken)
+}
+
+func TestDelete(t *testing.T) {
+	s, mr := bootstrapRedis(t)
+	fakeDatas := seedDataToDB(t, 1, s)
+	assert.Nil(t, s.IncrClicks(context.Background(), fakeDatas[0].Key, []model.ClickCount{
+		{Granularity: model.Daily, Start: model.BucketStart(time.Now(), model.Daily), Count: 1},
+		{Granularity: model.Hourly, Start: model.BucketStart(time.Now(), model.Hourly), Count: 1},
+	}))
+
+	cases := []struct {
+		name      string
+		input     string
+		wantError error
+	}{
+		{
+			name:      "should be able to delete existing data",
+			input:     fakeDatas[0].Key,
+			wantError: nil,
+		},
+		{
+			name:      "should return error if key doesn't exist anymore",
+			input:     fakeDatas[0].Key,
+			wantError: persist.ErrNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantError, s.Delete(context.Background(), tt.input))
+			_, err := s.Get(context.Background(), tt.input)
+			assert.Equal(t, persist.ErrNotFound, err)
+			assert.False(t, mr.Exists(persist.StatsKey(tt.input, model.Daily)))
+			assert.False(t, mr.Exists(persist.StatsKey(tt.input, model.Hourly)))
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	s, mr := bootstrapRedis(t)
+	fakeDatas := seedDataToDB(t, 1, s)
+	errAbort := errors.New("abort")
+	newExpiry := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+
+	cases := []struct {
+		name      string
+		input     string
+		fn        func(data *model.ShortenedData) error
+		wantOrig  string
+		wantError error
+	}{
+		{
+			name:  "should be able to change destination and expiry",
+			input: fakeDatas[0].Key,
+			fn: func(data *model.ShortenedData) error {
+				data.Orig = "https://example.com/updated"
+				data.Expiry = newExpiry
+				return nil
+			},
+			wantOrig: "https://example.com/updated",
+		},
+		{
+			name:  "should not change anything if fn returns an error",
+			input: fakeDatas[0].Key,
+			fn: func(data *model.ShortenedData) error {
+				data.Orig = "https://example.com/aborted"
+				return errAbort
+			},
+			wantOrig:  "https://example.com/updated",
+			wantError: errAbort,
+		},
+		{
+			name:  "should return error if key doesn't exist",
+			input: "aBCV3441",
+			fn: func(data *model.ShortenedData) error {
+				return nil
+			},
+			wantError: persist.ErrNotFound,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Update(context.Background(), tt.input, tt.fn)
+			assert.Equal(t, tt.wantError, err)
+
+			if tt.wantOrig != "" {
+				got, err := s.Get(context.Background(), tt.input)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.wantOrig, got.Orig)
+				assert.True(t, newExpiry.Equal(got.Expiry))
+				// the TTL of the key follows the new expiry
+				assert.InDelta(t, time.Until(newExpiry).Seconds(), mr.TTL(tt.input).Seconds(), 5)
+			}
+		})
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+	sd, err := model.NewAlias("https://example.com/invite", "invite", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.MaxUses = 5
+	if err = s.Set(context.Background(), sd); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var consumed, usedUp int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Update(context.Background(), sd.Key, (*model.ShortenedData).Consume)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&consumed, 1)
+			case errors.Is(err, model.ErrUsedUp):
+				atomic.AddInt32(&usedUp, 1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(5), consumed)
+	assert.Equal(t, int32(15), usedUp)
+	got, err := s.Get(context.Background(), sd.Key)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, got.Uses)
+}
+
+func TestList(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+	fakeDatas := seedDataToDB(t, 5, s)
+	for _, f := range fakeDatas {
+		assert.Nil(t, s.IncrClicks(context.Background(), f.Key, []model.ClickCount{
+			{Granularity: model.Daily, Start: model.BucketStart(time.Now(), model.Daily), Count: 1},
+		}))
+	}
+
+	// miniredis ignores the COUNT hint of SCAN, the walk still has to follow the cursor until redis returns 0
+	seen := map[string]int{}
+	cursor := ""
+	for {
+		links, next, err := s.List(context.Background(), cursor, 2)
+		assert.Nil(t, err)
+		for _, l := range links {
+			assert.False(t, persist.IsInternalKey(l.Key))
+			seen[l.Key]++
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	assert.Len(t, seen, len(fakeDatas))
+	for _, f := range fakeDatas {
+		assert.Equal(t, 1, seen[f.Key], "key %s should be listed exactly once", f.Key)
+	}
+
+	for _, limit := range []int{0, -1} {
+		_, _, err := s.List(context.Background(), "", limit)
+		assert.ErrorIs(t, err, persist.ErrInvalidLimit)
+	}
+
+	_, _, err := s.List(context.Background(), "not-a-cursor", 2)
+	assert.NotNil(t, err)
+}
+
+func TestClicks(t *testing.T) {
+	s, mr := bootstrapRedis(t)
+	fakeDatas := seedDataToDB(t, 1, s)
+	key := fakeDatas[0].Key
+
+	hour := model.BucketStart(time.Now(), model.Hourly)
+	day := model.BucketStart(time.Now(), model.Daily)
+	counts := []model.ClickCount{
+		{Granularity: model.Hourly, Start: hour, Count: 2},
+		{Granularity: model.Daily, Start: day, Count: 2},
+	}
+	assert.Nil(t, s.IncrClicks(context.Background(), key, counts))
+
+	// a bucket left over from a link clicked long ago is pruned on the next click
+	stale := hour.Add(-persist.HourlyStatsRetention - time.Hour)
+	staleField := strconv.FormatInt(stale.Unix(), 10)
+	mr.HSet(persist.StatsKey(key, model.Hourly), staleField, "7")
+
+	got, err := s.Clicks(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ClickCount{
+		{Granularity: model.Daily, Start: day, Count: 2},
+		{Granularity: model.Hourly, Start: hour, Count: 2},
+	}, got, "stale buckets should not be listed even before they are pruned")
+
+	assert.Nil(t, s.IncrClicks(context.Background(), key, counts))
+	fields, err := mr.HKeys(persist.StatsKey(key, model.Hourly))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{strconv.FormatInt(hour.Unix(), 10)}, fields)
+	assert.Greater(t, mr.TTL(persist.StatsKey(key, model.Hourly)), time.Duration(0))
+
+	got, err = s.Clicks(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, []model.ClickCount{
+		{Granularity: model.Daily, Start: day, Count: 4},
+		{Granularity: model.Hourly, Start: hour, Count: 4},
+	}, got)
+}
+
+func TestSetMany(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+
+	existing, err := model.NewAlias("https://example.com/q3-report.pdf", "q3-report", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(context.Background(), existing); err != nil {
+		t.Fatal(err)
+	}
+
+	newLink := func(orig, alias string, ttl time.Duration) *model.ShortenedData {
+		sd, err := model.NewAlias(orig, alias, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sd
+	}
+	past := newLink("https://example.com/past.pdf", "past-report", time.Hour)
+	past.Expiry = time.Now().Add(-time.Minute)
+
+	cases := []struct {
+		name      string
+		data      *model.ShortenedData
+		wantError error
+		wantOrig  string
+	}{
+		{
+			name:     "should write a new link",
+			data:     newLink("https://example.com/q4-report.pdf", "q4-report", time.Hour),
+			wantOrig: "https://example.com/q4-report.pdf",
+		},
+		{
+			name:     "setting an existing link again doesn't result in any error",
+			data:     newLink(existing.Orig, existing.Short, time.Hour),
+			wantOrig: existing.Orig,
+		},
+		{
+			name:      "should not be able to take an alias used by another url",
+			data:      newLink("https://example.com/other.pdf", existing.Short, time.Hour),
+			wantError: persist.ErrAliasTaken,
+			wantOrig:  existing.Orig,
+		},
+		{
+			name:      "should not be able to take an alias used earlier in the batch",
+			data:      newLink("https://example.com/other.pdf", "q4-report", time.Hour),
+			wantError: persist.ErrAliasTaken,
+			wantOrig:  "https://example.com/q4-report.pdf",
+		},
+		{
+			name:      "should refuse a link which already expired",
+			data:      past,
+			wantError: persist.ErrInvalidExpiry,
+		},
+	}
+
+	data := make([]*model.ShortenedData, len(cases))
+	for i, tt := range cases {
+		data[i] = tt.data
+	}
+	errs, err := s.SetMany(context.Background(), data)
+	assert.Nil(t, err)
+
+	for i, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantError, errs[i])
+			got, err := s.Get(context.Background(), tt.data.Key)
+			if tt.wantOrig == "" {
+				assert.Equal(t, persist.ErrNotFound, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantOrig, got.Orig)
+		})
+	}
+}
+
+func TestSaveManyCollision(t *testing.T) {
+	s, _ := bootstrapRedis(t)
+
+	// every URL gets the same code on the first attempt
+	collidingGen := shortcode.GeneratorFunc(func(orig string, attempt int) (string, error) {
+		return "COLLIDE" + strconv.Itoa(attempt), nil
+	})
+
+	var data []*model.ShortenedData
+	for _, orig := range []string{"https://example.com/first", "https://example.com/second", "https://example.com/third"} {
+		sd, err := model.NewWithGenerator(orig, time.Hour, collidingGen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, sd)
+	}
+
+	errs, err := persist.SaveMany(context.Background(), s, data, collidingGen)
+	assert.Nil(t, err)
+	for i, want := range data {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, "COLLIDE"+strconv.Itoa(i), want.Short)
+		got, err := s.Get(context.Background(), want.Short)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Orig, got.Orig)
+	}
+}
@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+)
+
+// IncrClicks implements persist.StatsStore, counters of each granularity are kept in a hash
+// keyed by the unix timestamp of the bucket start
+// the expiry of a hash is refreshed on every click, so the buckets older than the retention are deleted along
+func (s *Store) IncrClicks(ctx context.Context, key string, counts []model.ClickCount) error {
+	stale, err := s.staleBuckets(ctx, key, counts)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.rc.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, c := range counts {
+			k := persist.StatsKey(key, c.Granularity)
+			pipe.HIncrBy(ctx, k, strconv.FormatInt(c.Start.Unix(), 10), c.Count)
+			pipe.Expire(ctx, k, persist.StatsRetention(c.Granularity))
+		}
+		for k, fields := range stale {
+			pipe.HDel(ctx, k, fields...)
+		}
+		return nil
+	})
+	return err
+}
+
+// staleBuckets returns the fields of the counters of key older than the retention, by hash
+// only the granularities of counts are looked at
+func (s *Store) staleBuckets(ctx context.Context, key string, counts []model.ClickCount) (map[string][]string, error) {
+	cmds := map[string]*redis.StringSliceCmd{}
+	_, err := s.rc.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, c := range counts {
+			if _, ok := cmds[c.Granularity]; !ok {
+				cmds[c.Granularity] = pipe.HKeys(ctx, persist.StatsKey(key, c.Granularity))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stale := map[string][]string{}
+	for gran, cmd := range cmds {
+		oldest := time.Now().Add(-persist.StatsRetention(gran))
+		for _, field := range cmd.Val() {
+			unix, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				continue
+			}
+			if time.Unix(unix, 0).Before(oldest) {
+				k := persist.StatsKey(key, gran)
+				stale[k] = append(stale[k], field)
+			}
+		}
+	}
+	return stale, nil
+}
+
+// Clicks implements persist.StatsStore
+// buckets which got older than the retention since the last click are filtered here
+func (s *Store) Clicks(ctx context.Context, key string) ([]model.ClickCount, error) {
+	var res []model.ClickCount
+	for _, gran := range []string{model.Daily, model.Hourly} {
+		vals, err := s.rc.HGetAll(ctx, persist.StatsKey(key, gran)).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		oldest := time.Now().Add(-persist.StatsRetention(gran))
+		for field, val := range vals {
+			unix, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			start := time.Unix(unix, 0).UTC()
+			if start.Before(oldest) {
+				continue
+			}
+			res = append(res, model.ClickCount{Granularity: gran, Start: start, Count: n})
+		}
+	}
+	persist.SortClicks(res)
+	return res, nil
+}
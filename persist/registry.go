@@ -0,0 +1,59 @@
+package persist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alexadhy/shortener/config"
+)
+
+// Factory creates a Persist from the application options
+type Factory func(opts config.Options) (Persist, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes a backend available by name to Open
+// backends register themselves from an init function, so importing their package is enough to use them
+// it panics if Register is called twice with the same name or if f is nil
+func Register(name string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if f == nil {
+		panic("persist: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("persist: Register called twice for backend " + name)
+	}
+	factories[name] = f
+}
+
+// Backends returns the sorted names of the registered backends
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates the Persist of the backend selected by opts.Backend
+func Open(opts config.Options) (Persist, error) {
+	factoriesMu.RLock()
+	f, ok := factories[opts.Backend]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (forgotten import?), available: %s", opts.Backend, strings.Join(Backends(), ", "))
+	}
+	return f(opts)
+}
@@ -0,0 +1,57 @@
+package persist_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexadhy/shortener/config"
+	"github.com/alexadhy/shortener/persist"
+	"github.com/alexadhy/shortener/persist/memory"
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  string
+		hasError bool
+	}{
+		{
+			name:    "should open a registered backend",
+			backend: "memory",
+		},
+		{
+			name:     "should fail on an unknown backend",
+			backend:  "cassandra",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := persist.Open(config.Options{Backend: tt.backend})
+			if tt.hasError {
+				if err == nil || !strings.Contains(err.Error(), "memory") {
+					t.Fatalf("expecting an error listing the available backends, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := p.(*memory.Store); !ok {
+				t.Fatalf("expecting *memory.Store, got: %T", p)
+			}
+		})
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering the same backend twice should panic")
+		}
+	}()
+	persist.Register("memory", func(_ config.Options) (persist.Persist, error) {
+		return memory.New(), nil
+	})
+}
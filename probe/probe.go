@@ -0,0 +1,214 @@
+// Package probe checks that the destination of a link responds, without letting it reach the internal network
+// the addresses are checked after DNS resolution and connected to directly, for every redirect
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alexadhy/shortener/model"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultMaxRedirects = 5
+	defaultUserAgent    = "shortener-probe/1.0"
+	maxHeaderBytes      = 64 << 10
+)
+
+var (
+	// ErrForbiddenAddress is returned for the destinations resolving to an address which isn't allowed, see Public
+	ErrForbiddenAddress = errors.New("destination resolves to a non public address")
+	// ErrTooManyRedirects is returned when the destination redirects more than allowed
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrScheme is returned when the destination redirects to another scheme than http or https
+	ErrScheme = errors.New("redirect to an unsupported scheme")
+)
+
+// Resolver looks up the addresses of a host, *net.Resolver implements it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Options configures a Prober, the zero value is usable
+type Options struct {
+	// Timeout bounds a whole check, redirects included
+	Timeout time.Duration
+	// MaxRedirects is how many redirects are followed, a negative value follows none and reports the redirect itself
+	MaxRedirects int
+	// Resolver defaults to net.DefaultResolver
+	Resolver Resolver
+	// Allowed tells whether an address can be connected to, defaults to Public
+	Allowed   func(ip net.IP) bool
+	UserAgent string
+}
+
+// Prober checks destinations, it is safe for concurrent use
+type Prober struct {
+	opts   Options
+	client *http.Client
+}
+
+// New returns a Prober, the zero values of opts are defaulted
+func New(opts Options) *Prober {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = defaultMaxRedirects
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	if opts.Allowed == nil {
+		opts.Allowed = Public
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = defaultUserAgent
+	}
+
+	p := &Prober{opts: opts}
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	p.client = &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			// a proxy would connect to the addresses on our behalf, unchecked
+			Proxy: nil,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return p.dial(ctx, dialer, network, addr)
+			},
+			TLSHandshakeTimeout:    opts.Timeout,
+			ResponseHeaderTimeout:  opts.Timeout,
+			MaxResponseHeaderBytes: maxHeaderBytes,
+			DisableKeepAlives:      true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if opts.MaxRedirects < 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > opts.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrScheme
+			}
+			return nil
+		},
+	}
+	return p
+}
+
+// Probe requests u, following its redirects, and returns the outcome
+// the error the check failed with, if any, is also returned, e.g. ErrForbiddenAddress
+func (p *Prober) Probe(ctx context.Context, u string) (model.Probe, error) {
+	res := model.Probe{Checked: time.Now().UTC()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res, err
+	}
+	req.Header.Set("User-Agent", p.opts.UserAgent)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// the URL is already known, only the cause is kept
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		res.Error = err.Error()
+		return res, err
+	}
+	// the body isn't read, the status is all that matters
+	_ = resp.Body.Close()
+	res.StatusCode = resp.StatusCode
+	res.FinalURL = resp.Request.URL.String()
+	return res, nil
+}
+
+// dial connects to the first allowed address of the host of addr
+// the host is refused if any of its addresses isn't allowed, so that it can't switch to them between lookups
+func (p *Prober) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := p.opts.Resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no address found for %s", host)
+	}
+	for _, ip := range ips {
+		if !p.opts.Allowed(ip) {
+			return nil, fmt.Errorf("%w: %s is %s", ErrForbiddenAddress, host, ip)
+		}
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// reserved are the special purpose ranges not covered by the methods of net.IP
+var reserved = mustParseCIDRs(
+	"0.0.0.0/8",       // this network
+	"100.64.0.0/10",   // carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved, and broadcast
+	"64:ff9b::/96",    // NAT64, may embed a private IPv4 address
+	"64:ff9b:1::/48",  // local-use NAT64
+	"2001:db8::/32",   // documentation
+)
+
+// Public reports whether ip is a public unicast address
+// private, loopback, link-local, multicast and the other special purpose ranges are refused
+func Public(ip net.IP) bool {
+	if ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range reserved {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
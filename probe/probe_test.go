@@ -0,0 +1,169 @@
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/probe"
+)
+
+// resolver answers with fixed addresses
+type resolver map[string][]string
+
+func (r resolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(ip)}
+	}
+	return addrs, nil
+}
+
+// loopbackOnly stands in for the public internet, so that the httptest servers can be reached
+func loopbackOnly(ip net.IP) bool {
+	return ip.IsLoopback()
+}
+
+func TestPublic(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "10.1.2.3", want: false},
+		{ip: "172.16.0.1", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "100.64.0.1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "255.255.255.255", want: false},
+		{ip: "224.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "::", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "::ffff:10.0.0.1", want: false},
+		{ip: "64:ff9b::a00:1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, probe.Public(net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "shortener-probe/1.0", r.UserAgent())
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://metadata.internal/latest/", http.StatusFound)
+	})
+	mux.HandleFunc("/ftp", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := u.Port()
+	p := probe.New(probe.Options{
+		Timeout:      200 * time.Millisecond,
+		MaxRedirects: 3,
+		Allowed:      loopbackOnly,
+		Resolver: resolver{
+			"public.example":    {"127.0.0.1"},
+			"metadata.internal": {"169.254.169.254"},
+			"mixed.example":     {"127.0.0.1", "10.0.0.1"},
+		},
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		status   int
+		finalURL string
+		err      error
+		broken   bool
+	}{
+		{name: "should report the status", url: "http://public.example:" + port + "/ok", status: http.StatusOK, finalURL: "http://public.example:" + port + "/ok"},
+		{name: "should report a missing page", url: "http://public.example:" + port + "/missing", status: http.StatusNotFound, finalURL: "http://public.example:" + port + "/missing", broken: true},
+		{name: "should follow redirects", url: "http://public.example:" + port + "/moved", status: http.StatusOK, finalURL: "http://public.example:" + port + "/ok"},
+		{name: "should stop following redirects", url: "http://public.example:" + port + "/loop", err: probe.ErrTooManyRedirects, broken: true},
+		{name: "should refuse a redirect to a forbidden address", url: "http://public.example:" + port + "/internal", err: probe.ErrForbiddenAddress, broken: true},
+		{name: "should refuse a redirect to another scheme", url: "http://public.example:" + port + "/ftp", err: probe.ErrScheme, broken: true},
+		{name: "should refuse a forbidden address", url: "http://metadata.internal/latest/", err: probe.ErrForbiddenAddress, broken: true},
+		{name: "should refuse a host with a forbidden address", url: "http://mixed.example:" + port + "/ok", err: probe.ErrForbiddenAddress, broken: true},
+		{name: "should refuse a forbidden IP", url: "http://10.0.0.1/", err: probe.ErrForbiddenAddress, broken: true},
+		{name: "should report an unknown host", url: "http://unknown.example/", broken: true},
+		{name: "should time out", url: "http://public.example:" + port + "/slow", broken: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := p.Probe(context.Background(), tt.url)
+			assert.Equal(t, tt.status, res.StatusCode)
+			assert.Equal(t, tt.finalURL, res.FinalURL)
+			assert.Equal(t, tt.broken, res.Broken())
+			assert.False(t, res.Checked.IsZero())
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "expected %v, got %v", tt.err, err)
+			}
+			// the destination either answered, or the check failed
+			if tt.status == 0 {
+				assert.NotNil(t, err)
+				assert.NotEmpty(t, res.Error)
+			} else {
+				assert.Nil(t, err)
+				assert.Empty(t, res.Error)
+			}
+		})
+	}
+}
+
+func TestProbeDefaults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusMovedPermanently)
+	}))
+	defer srv.Close()
+
+	// the httptest server is on the loopback interface
+	_, err := probe.New(probe.Options{}).Probe(context.Background(), srv.URL)
+	assert.True(t, errors.Is(err, probe.ErrForbiddenAddress))
+
+	res, err := probe.New(probe.Options{MaxRedirects: -1, Allowed: loopbackOnly}).Probe(context.Background(), srv.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+}
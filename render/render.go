@@ -1,8 +1,21 @@
 package render
 
 import (
+	"bytes"
 	"encoding/json"
+	"html/template"
+	"mime"
 	"net/http"
+	"strings"
+)
+
+const (
+	// ContentTypeJSON is the content type of regular responses
+	ContentTypeJSON = "application/json; charset=utf-8"
+	// ContentTypeProblem is the content type of RFC 7807 problem details
+	ContentTypeProblem = "application/problem+json"
+	// ContentTypeHTML is the content type of the pages meant for browsers
+	ContentTypeHTML = "text/html; charset=utf-8"
 )
 
 // Response is just a generic structure over response
@@ -10,13 +23,49 @@ type Response[DataType any] struct {
 	Headers    map[string]string `json:"-"`
 	StatusCode int               `json:"-"`
 	Data       DataType          `json:"data,omitempty" qs:"-"`
-	Err        error             `json:"error,omitempty"`
+	Err        *Error            `json:"error,omitempty"`
+}
+
+// Error is the error envelope of every failed response
+// Code is stable and meant to be matched by clients, Message is meant for humans
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// NewError creates an Error with the given code, using the message of err
+func NewError(code string, err error) *Error {
+	return &Error{Code: code, Message: err.Error()}
+}
+
+// WithDetails sets optional details of the error and returns it
+func (e *Error) WithDetails(details any) *Error {
+	e.Details = details
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Problem is the RFC 7807 representation of an Error
+type Problem struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Status  int    `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	Code    string `json:"code"`
+	Details any    `json:"details,omitempty"`
 }
 
 func render[T any](resp Response[T], w http.ResponseWriter) (int, error) {
 	for k, v := range resp.Headers {
 		w.Header().Add(k, v)
 	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+	}
 	w.WriteHeader(resp.StatusCode)
 	b, _ := json.Marshal(&resp)
 	return w.Write(b)
@@ -25,3 +74,52 @@ func render[T any](resp Response[T], w http.ResponseWriter) (int, error) {
 func Render(resp Response[any], w http.ResponseWriter) (int, error) {
 	return render[any](resp, w)
 }
+
+// RenderError writes e with the given status code, as problem details if the client asked for
+// application/problem+json, in the regular error envelope otherwise
+func RenderError(w http.ResponseWriter, r *http.Request, statusCode int, e *Error) (int, error) {
+	if !Accepts(r, ContentTypeProblem) {
+		return Render(Response[any]{StatusCode: statusCode, Err: e}, w)
+	}
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(statusCode)
+	b, _ := json.Marshal(Problem{
+		Type:    "about:blank",
+		Title:   http.StatusText(statusCode),
+		Status:  statusCode,
+		Detail:  e.Message,
+		Code:    e.Code,
+		Details: e.Details,
+	})
+	return w.Write(b)
+}
+
+// HTML executes the template name of t with data and writes it with the given status code
+// the template is executed before anything is written, so a failure can still be answered with an error
+func HTML(w http.ResponseWriter, statusCode int, t *template.Template, name string, data any) (int, error) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		return 0, err
+	}
+	w.Header().Set("Content-Type", ContentTypeHTML)
+	w.WriteHeader(statusCode)
+	return w.Write(buf.Bytes())
+}
+
+// Accepts reports whether the Accept header of r explicitly lists the media type mediaType
+// wildcards are ignored, so that it can be used to opt-in to alternative representations
+func Accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mt != mediaType {
+			continue
+		}
+		if q, ok := params["q"]; ok && strings.Trim(q, "0.") == "" {
+			// q=0 means not acceptable
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package shortcode
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/zeebo/blake3"
+)
+
+const (
+	counterBits   = 40
+	counterHalf   = counterBits / 2
+	counterMask   = 1<<counterHalf - 1
+	counterMax    = 1<<counterBits - 1
+	counterLen    = 7 // 62^7 > 2^40
+	counterRounds = 4
+)
+
+// Counter generates codes from a monotonic counter, the sequential IDs are obfuscated with a
+// Feistel network keyed by a salt so that consecutive codes don't look consecutive.
+// Every counter value maps to a distinct 7 characters base62 code
+type Counter struct {
+	next uint64
+	keys [counterRounds]uint32
+}
+
+// NewCounter creates a counter based generator starting at start
+// the salt has to be kept the same across restarts, and start should be past the last issued value
+// (e.g. derived from the current time) otherwise codes issued earlier will be generated again
+// and will have to be skipped on collision
+func NewCounter(salt string, start uint64) *Counter {
+	c := &Counter{next: start}
+	sum := blake3.Sum256([]byte(salt))
+	for i := range c.keys {
+		c.keys[i] = binary.LittleEndian.Uint32(sum[i*4:])
+	}
+	return c
+}
+
+// Generate implements Generator
+func (c *Counter) Generate(_ string, _ int) (string, error) {
+	n := atomic.AddUint64(&c.next, 1) - 1
+	if n > counterMax {
+		return "", ErrExhausted
+	}
+	return encodeBase62(c.permute(n), counterLen), nil
+}
+
+// permute maps n to a unique value in the same range
+func (c *Counter) permute(n uint64) uint64 {
+	l, r := uint32(n>>counterHalf), uint32(n&counterMask)
+	for _, k := range c.keys {
+		l, r = r, l^round(r, k)
+	}
+	return uint64(l)<<counterHalf | uint64(r)
+}
+
+func round(x, k uint32) uint32 {
+	h := x ^ k
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h & counterMask
+}
+
+// encodeBase62 encodes n in base62, left padded to length
+func encodeBase62(n uint64, length int) string {
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = base62[n%62]
+		n /= 62
+	}
+	return string(b)
+}
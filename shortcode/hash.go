@@ -0,0 +1,26 @@
+package shortcode
+
+import (
+	"strings"
+
+	"github.com/alexadhy/shortener/internal/hash"
+)
+
+// Hash is the deterministic generator, the same URL always gets the same code
+// codes are the first 8 characters of the base36 encoded BLAKE3 digest of the URL,
+// on collision they are extended with the next characters of the hex digest
+type Hash struct{}
+
+// Generate implements Generator
+func (Hash) Generate(orig string, attempt int) (string, error) {
+	sum, short := hash.Hash(orig)
+	if attempt == 0 {
+		return short, nil
+	}
+
+	end := len(short) + attempt
+	if end > len(sum) {
+		return "", ErrExhausted
+	}
+	return short + strings.ToUpper(sum[len(short):end]), nil
+}
@@ -0,0 +1,50 @@
+package shortcode
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+const defaultRandomLen = 7
+
+// Random generates random base62 codes, the same URL gets a different code every time
+type Random struct {
+	length int
+}
+
+// NewRandom creates a random generator for codes of the given length
+// length defaults to 7 if it is not positive
+func NewRandom(length int) Random {
+	if length <= 0 {
+		length = defaultRandomLen
+	}
+	return Random{length: length}
+}
+
+// Generate implements Generator
+func (r Random) Generate(_ string, _ int) (string, error) {
+	length := r.length
+	if length <= 0 {
+		length = defaultRandomLen
+	}
+
+	sb := strings.Builder{}
+	sb.Grow(length)
+	buf := make([]byte, length*2)
+	for sb.Len() < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// 248 is the largest multiple of 62 below 256, discard anything above to avoid modulo bias
+			if b >= 248 {
+				continue
+			}
+			sb.WriteByte(base62[b%62])
+			if sb.Len() == length {
+				break
+			}
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,50 @@
+// Package shortcode contains the generators used to derive short codes from URLs
+package shortcode
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrExhausted is returned by a Generator when it can't derive any more alternate codes
+var ErrExhausted = errors.New("no more short codes can be generated")
+
+// Generator generates short codes for URLs
+type Generator interface {
+	// Generate returns the short code for orig, attempt starts at 0 and is increased every time
+	// the previously generated code collided with a different URL
+	Generate(orig string, attempt int) (string, error)
+}
+
+// GeneratorFunc is an adapter to allow the use of ordinary functions as Generator
+type GeneratorFunc func(orig string, attempt int) (string, error)
+
+// Generate calls f(orig, attempt)
+func (f GeneratorFunc) Generate(orig string, attempt int) (string, error) {
+	return f(orig, attempt)
+}
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Generator types accepted by New
+const (
+	TypeHash    = "hash"
+	TypeRandom  = "random"
+	TypeCounter = "counter"
+)
+
+// New creates a Generator by its type name
+// length is only used by the random generator, salt only by the counter generator
+func New(typ string, length int, salt string) (Generator, error) {
+	switch typ {
+	case TypeHash, "":
+		return Hash{}, nil
+	case TypeRandom:
+		return NewRandom(length), nil
+	case TypeCounter:
+		return NewCounter(salt, uint64(time.Now().Unix())), nil
+	default:
+		return nil, fmt.Errorf("unknown short code generator %q", typ)
+	}
+}
@@ -0,0 +1,136 @@
+package shortcode
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	const orig = "https://qa.omh.life/console/ohmyhome/listings?accountUid=200b8b81656f7dca38c57ab87bfaac89"
+
+	tests := []struct {
+		name     string
+		attempt  int
+		expected string
+		hasError bool
+	}{
+		{
+			name:     "should return the hash derived code on the first attempt",
+			attempt:  0,
+			expected: "67UOYTH8",
+		},
+		{
+			name:     "should extend the code with the digest on later attempts",
+			attempt:  2,
+			expected: "67UOYTH87A",
+		},
+		{
+			name:     "should be exhausted once the digest is used up",
+			attempt:  64,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Hash{}.Generate(orig, tt.attempt)
+			if tt.hasError {
+				if err != ErrExhausted {
+					t.Fatalf("expecting %v, got: %v", ErrExhausted, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.expected {
+				t.Fatalf("expecting %s, got: %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRandom(t *testing.T) {
+	tests := []struct {
+		name     string
+		gen      Random
+		expected int
+	}{
+		{
+			name:     "should use the default length on zero value",
+			gen:      Random{},
+			expected: defaultRandomLen,
+		},
+		{
+			name:     "should use the configured length",
+			gen:      NewRandom(12),
+			expected: 12,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[string]struct{}{}
+			for i := 0; i < 1000; i++ {
+				got, err := tt.gen.Generate("https://example.com", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != tt.expected {
+					t.Fatalf("expecting length %d, got: %s", tt.expected, got)
+				}
+				if strings.Trim(got, base62) != "" {
+					t.Fatalf("expecting base62 code, got: %s", got)
+				}
+				if _, ok := seen[got]; ok {
+					t.Fatalf("duplicate code %s", got)
+				}
+				seen[got] = struct{}{}
+			}
+		})
+	}
+}
+
+func TestCounter(t *testing.T) {
+	gen := NewCounter("salt", 1000)
+	seen := map[string]struct{}{}
+	prev := ""
+	ordered := 0
+	for i := 0; i < 100000; i++ {
+		got, err := gen.Generate("", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != counterLen {
+			t.Fatalf("expecting length %d, got: %s", counterLen, got)
+		}
+		if _, ok := seen[got]; ok {
+			t.Fatalf("duplicate code %s after %d codes", got, i)
+		}
+		seen[got] = struct{}{}
+		if got > prev {
+			ordered++
+		}
+		prev = got
+	}
+
+	// sequential ids should not produce sequential codes
+	if ordered > 60000 {
+		t.Fatalf("codes look sequential, %d out of 100000 are increasing", ordered)
+	}
+
+	// the same salt and counter value always gives the same code
+	a, _ := NewCounter("salt", 42).Generate("", 0)
+	b, _ := NewCounter("salt", 42).Generate("", 0)
+	c, _ := NewCounter("pepper", 42).Generate("", 0)
+	if a != b {
+		t.Fatalf("expecting %s, got: %s", a, b)
+	}
+	if a == c {
+		t.Fatalf("different salts should give different codes, got %s twice", a)
+	}
+
+	if _, err := NewCounter("salt", counterMax+1).Generate("", 0); err != ErrExhausted {
+		t.Fatalf("expecting %v, got: %v", ErrExhausted, err)
+	}
+}
@@ -0,0 +1,224 @@
+package threat
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/alexadhy/shortener/domainpolicy"
+	"github.com/alexadhy/shortener/urlnorm"
+)
+
+const (
+	// ListHost, ListURLPrefix and ListHashPrefix are the lists a URL can be matched by, see Match
+	ListHost       = "host"
+	ListURLPrefix  = "url_prefix"
+	ListHashPrefix = "hash_prefix"
+
+	minHashPrefixLen = 4
+	maxHostSuffixes  = 5
+	maxPathPrefixes  = 4
+)
+
+// Match tells which entry of which list a URL was matched by
+type Match struct {
+	List  string
+	Entry string
+}
+
+func (m Match) String() string {
+	return m.List + ": " + m.Entry
+}
+
+// Lists are the threat lists a URL is checked against
+//   - hosts, in the format of domainpolicy.Rules, e.g. phishing.example or *.malware.example
+//   - URL prefixes, e.g. https://example.com/~attacker/, they are compared to the canonical form of the URL
+//   - hash prefixes in hex, of at least 4 bytes, of the SHA-256 of the host suffix and path prefix expressions of a URL
+//     as defined by Google Safe Browsing, e.g. the hash of "evil.example/login/"
+type Lists struct {
+	hosts    *domainpolicy.Rules
+	prefixes map[string][]string
+	hashes   map[int]map[string]struct{}
+}
+
+// Len returns the number of entries of the lists
+func (l *Lists) Len() int {
+	n := l.hosts.Len()
+	for _, p := range l.prefixes {
+		n += len(p)
+	}
+	for _, h := range l.hashes {
+		n += len(h)
+	}
+	return n
+}
+
+// LoadLists reads the lists from files, one entry per line, blank lines and comments starting with # are skipped
+func LoadLists(hostFiles, prefixFiles, hashFiles []string) (*Lists, error) {
+	hosts, err := domainpolicy.LoadRules(nil, hostFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("hosts: %w", err)
+	}
+	l := &Lists{hosts: hosts, prefixes: map[string][]string{}, hashes: map[int]map[string]struct{}{}}
+	for _, name := range prefixFiles {
+		if err = readFile(name, l.addPrefix); err != nil {
+			return nil, fmt.Errorf("url prefixes: %w", err)
+		}
+	}
+	for _, name := range hashFiles {
+		if err = readFile(name, l.addHash); err != nil {
+			return nil, fmt.Errorf("hash prefixes: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Match returns the first entry u is matched by, u is expected to be an absolute URL
+func (l *Lists) Match(u string) (Match, bool) {
+	norm, err := canonical(u)
+	if err != nil {
+		return Match{}, false
+	}
+	parsed, err := url.Parse(norm)
+	if err != nil {
+		return Match{}, false
+	}
+	host := parsed.Hostname()
+
+	if l.hosts.Match(host) {
+		return Match{List: ListHost, Entry: host}, true
+	}
+	for _, p := range l.prefixes[host] {
+		if strings.HasPrefix(norm, p) {
+			return Match{List: ListURLPrefix, Entry: p}, true
+		}
+	}
+	if len(l.hashes) > 0 {
+		for _, expr := range Expressions(parsed) {
+			sum := sha256.Sum256([]byte(expr))
+			for n, set := range l.hashes {
+				if _, ok := set[string(sum[:n])]; ok {
+					return Match{List: ListHashPrefix, Entry: hex.EncodeToString(sum[:n])}, true
+				}
+			}
+		}
+	}
+	return Match{}, false
+}
+
+// Expressions returns the host suffix and path prefix combinations of u hashed for the hash prefix list
+// following Google Safe Browsing: up to 5 host suffixes and the exact path, with and without query, along with up to 4 path prefixes
+func Expressions(u *url.URL) []string {
+	host := strings.ToLower(u.Hostname())
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		start := len(labels) - maxHostSuffixes
+		if start < 1 {
+			start = 1
+		}
+		for i := start; i < len(labels)-1; i++ {
+			hosts = append(hosts, strings.Join(labels[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	// the last segment is the file name, or empty for a directory
+	segments := strings.Split(path[1:], "/")
+	dirs := segments[:len(segments)-1]
+	prefix := "/"
+	for i := 0; i < maxPathPrefixes; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		if i >= len(dirs) {
+			break
+		}
+		prefix += dirs[i] + "/"
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			exprs = append(exprs, h+p)
+		}
+	}
+	return exprs
+}
+
+func (l *Lists) addPrefix(entry string) error {
+	norm, err := canonical(entry)
+	if err != nil {
+		return fmt.Errorf("invalid URL prefix %q: %w", entry, err)
+	}
+	u, err := url.Parse(norm)
+	if err != nil {
+		return err
+	}
+	l.prefixes[u.Hostname()] = append(l.prefixes[u.Hostname()], norm)
+	return nil
+}
+
+func (l *Lists) addHash(entry string) error {
+	b, err := hex.DecodeString(strings.ToLower(entry))
+	if err != nil || len(b) < minHashPrefixLen || len(b) > sha256.Size {
+		return fmt.Errorf("invalid hash prefix %q, expecting %d to %d hex encoded bytes", entry, minHashPrefixLen, sha256.Size)
+	}
+	if l.hashes[len(b)] == nil {
+		l.hashes[len(b)] = map[string]struct{}{}
+	}
+	l.hashes[len(b)][string(b)] = struct{}{}
+	return nil
+}
+
+// normalizer canonicalizes the URLs and URL prefixes the same way, the prefixes of any scheme can be listed
+var normalizer = urlnorm.New(urlnorm.Options{Schemes: []string{"http", "https", "ftp"}, StripFragment: true})
+
+func canonical(u string) (string, error) {
+	return normalizer.Normalize(u)
+}
+
+// readFile calls add for every entry of the file name, one per line, blank lines and comments starting with # are skipped
+func readFile(name string, add func(entry string) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = readEntries(f, add); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func readEntries(rd io.Reader, add func(entry string) error) error {
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		entry := sc.Text()
+		if i := strings.IndexByte(entry, '#'); i >= 0 {
+			entry = entry[:i]
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := add(entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
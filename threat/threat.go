@@ -0,0 +1,188 @@
+// Package threat screens destination URLs against threat lists loaded from files, e.g. phishing or malware feeds
+// the lists are reloaded when the files change, and the stored links which became listed are disabled
+package threat
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alexadhy/shortener/internal/filewatch"
+	"github.com/alexadhy/shortener/internal/log"
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist"
+)
+
+const (
+	defaultReloadInterval = 5 * time.Minute
+	scanPageSize          = 500
+)
+
+// blockedLinks is the number of stored links disabled since the start, exported on /debug/vars
+var blockedLinks = expvar.NewInt("blocked_links")
+
+// Options configures a Screener, see Lists for the format of the files
+type Options struct {
+	HostFiles       []string
+	URLPrefixFiles  []string
+	HashPrefixFiles []string
+	// ReloadInterval is how often the files are checked for changes, defaulted if not positive
+	ReloadInterval time.Duration
+}
+
+// Screener checks URLs against the threat lists
+type Screener struct {
+	opts    Options
+	p       persist.Persist
+	watcher *filewatch.Watcher
+
+	mu    sync.RWMutex
+	lists *Lists
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New loads the lists of opts and starts watching their files, Close has to be called to stop it
+// if p isn't nil, the links stored in p are screened in the background at start and whenever the lists change,
+// and the listed ones disabled, see Scan
+func New(opts Options, p persist.Persist) (*Screener, error) {
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = defaultReloadInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Screener{opts: opts, p: p, ctx: ctx, cancel: cancel}
+	if err := s.Reload(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	files := append(append(append([]string{}, opts.HostFiles...), opts.URLPrefixFiles...), opts.HashPrefixFiles...)
+	if len(files) == 0 {
+		return s, nil
+	}
+	s.watcher = filewatch.New(files, opts.ReloadInterval, func() error {
+		if err := s.Reload(); err != nil {
+			return fmt.Errorf("threat lists: %w", err)
+		}
+		log.Infof("threat lists reloaded")
+		s.scan()
+		return nil
+	})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.scan()
+	}()
+	return s, nil
+}
+
+// Check returns the entry u is listed by, if it is
+func (s *Screener) Check(u string) (Match, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lists.Match(u)
+}
+
+// CheckLink returns the entry the destination or the fallback URL of sd is listed by, if one of them is
+func (s *Screener) CheckLink(sd *model.ShortenedData) (Match, bool) {
+	for _, u := range []string{sd.Orig, sd.Fallback, sd.Prelaunch} {
+		if u == "" {
+			continue
+		}
+		if m, ok := s.Check(u); ok {
+			return m, true
+		}
+	}
+	return Match{}, false
+}
+
+// Reload reads the lists again, the current ones are kept if one of them is invalid
+func (s *Screener) Reload() error {
+	lists, err := LoadLists(s.opts.HostFiles, s.opts.URLPrefixFiles, s.opts.HashPrefixFiles)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.lists = lists
+	s.mu.Unlock()
+	return nil
+}
+
+// Block disables the link stored in p under key because of m, it is a no-op if it already is
+func Block(ctx context.Context, p persist.Persist, key string, m Match) error {
+	blocked := false
+	_, err := p.Update(ctx, key, func(data *model.ShortenedData) error {
+		blocked = data.Blocked == ""
+		if blocked {
+			data.Blocked = m.String()
+		}
+		return nil
+	})
+	if err == nil && blocked {
+		blockedLinks.Add(1)
+		log.Infof("link %s blocked, its destination is listed by %s", key, m)
+	}
+	return err
+}
+
+// Scan walks every link stored in p and disables the ones whose destination is listed, it returns how many were
+func (s *Screener) Scan(ctx context.Context, p persist.Persist) (int, error) {
+	n := 0
+	cursor := ""
+	for {
+		links, next, err := p.List(ctx, cursor, scanPageSize)
+		if err != nil {
+			return n, err
+		}
+		for _, sd := range links {
+			if sd.Blocked != "" {
+				continue
+			}
+			m, ok := s.CheckLink(sd)
+			if !ok {
+				continue
+			}
+			err = Block(ctx, p, sd.Key, m)
+			if errors.Is(err, persist.ErrNotFound) {
+				// deleted or expired since it was listed
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+		if next == "" {
+			return n, nil
+		}
+		cursor = next
+	}
+}
+
+// Close stops watching the files, a running scan is cancelled
+func (s *Screener) Close() {
+	s.cancel()
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
+	s.wg.Wait()
+}
+
+// scan runs Scan on the store given to New, if any
+func (s *Screener) scan() {
+	if s.p == nil {
+		return
+	}
+	n, err := s.Scan(s.ctx, s.p)
+	if err != nil && s.ctx.Err() == nil {
+		log.Errorf("threat scan: %v", err)
+	}
+	if n > 0 {
+		log.Infof("threat scan blocked %d links", n)
+	}
+}
@@ -0,0 +1,198 @@
+package threat_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alexadhy/shortener/model"
+	"github.com/alexadhy/shortener/persist/memory"
+	"github.com/alexadhy/shortener/threat"
+)
+
+func writeList(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func hashPrefix(expr string, n int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:n])
+}
+
+func TestExpressions(t *testing.T) {
+	// the example of the Safe Browsing documentation
+	u, err := url.Parse("http://a.b.c/1/2.html?param=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"a.b.c/1/2.html?param=1",
+		"a.b.c/1/2.html",
+		"a.b.c/",
+		"a.b.c/1/",
+		"b.c/1/2.html?param=1",
+		"b.c/1/2.html",
+		"b.c/",
+		"b.c/1/",
+	}, threat.Expressions(u))
+
+	u, err = url.Parse("http://a.b.c.d.e.f.g/1.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"a.b.c.d.e.f.g/1.html", "a.b.c.d.e.f.g/",
+		"c.d.e.f.g/1.html", "c.d.e.f.g/",
+		"d.e.f.g/1.html", "d.e.f.g/",
+		"e.f.g/1.html", "e.f.g/",
+		"f.g/1.html", "f.g/",
+	}, threat.Expressions(u))
+
+	u, err = url.Parse("http://1.2.3.4/1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"1.2.3.4/1/", "1.2.3.4/"}, threat.Expressions(u))
+}
+
+func TestLists(t *testing.T) {
+	lists, err := threat.LoadLists(
+		[]string{writeList(t, "hosts.txt", "# phishing\nphishing.example\n*.malware.example\n")},
+		[]string{writeList(t, "prefixes.txt", "https://Files.example/~attacker/\n")},
+		[]string{writeList(t, "hashes.txt", hashPrefix("evil.example/login/", 4)+"\n"+hashPrefix("bad.example/", 32)+"\n")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 5, lists.Len())
+
+	tests := []struct {
+		url   string
+		list  string
+		match bool
+	}{
+		{url: "https://phishing.example/", list: threat.ListHost, match: true},
+		{url: "https://PHISHING.example:443/a?b=c", list: threat.ListHost, match: true},
+		{url: "http://cdn.malware.example/x.exe", list: threat.ListHost, match: true},
+		{url: "https://www.phishing.example/", match: false},
+		{url: "https://files.example/~attacker/payload", list: threat.ListURLPrefix, match: true},
+		{url: "http://files.example/~attacker/payload", match: false},
+		{url: "https://files.example/~someone/", match: false},
+		{url: "https://evil.example/login/index.php?next=/", list: threat.ListHashPrefix, match: true},
+		{url: "https://www.evil.example/login/", list: threat.ListHashPrefix, match: true},
+		{url: "https://evil.example/logout/", match: false},
+		{url: "https://a.bad.example/anything", list: threat.ListHashPrefix, match: true},
+		{url: "https://example.com/", match: false},
+		{url: "not a url", match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			m, ok := lists.Match(tt.url)
+			assert.Equal(t, tt.match, ok)
+			assert.Equal(t, tt.list, m.List)
+		})
+	}
+}
+
+func TestLoadListsInvalid(t *testing.T) {
+	_, err := threat.LoadLists(nil, nil, []string{writeList(t, "hashes.txt", "abc\n")})
+	assert.NotNil(t, err)
+
+	_, err = threat.LoadLists(nil, []string{writeList(t, "prefixes.txt", "/relative\n")}, nil)
+	assert.NotNil(t, err)
+
+	_, err = threat.LoadLists([]string{filepath.Join(t.TempDir(), "missing.txt")}, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestScreener(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	clean, err := model.New("https://example.com/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed, err := model.New("https://example.org/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viaFallback, err := model.New("https://example.net/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	viaFallback.Fallback = "https://example.org/expired"
+	for _, sd := range []*model.ShortenedData{clean, listed, viaFallback} {
+		if err = store.Set(ctx, sd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hosts := writeList(t, "hosts.txt", "phishing.example\n")
+	s, err := threat.New(threat.Options{HostFiles: []string{hosts}, ReloadInterval: 10 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, ok := s.Check("https://example.org/")
+	assert.False(t, ok)
+	n, err := s.Scan(ctx, store)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// the lists are reloaded once the file changes
+	if err = os.WriteFile(hosts, []byte("phishing.example\nexample.org\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err = os.Chtimes(hosts, future, future); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		_, ok := s.Check("https://example.org/")
+		return ok
+	}, time.Second, 5*time.Millisecond)
+
+	n, err = s.Scan(ctx, store)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	for _, tt := range []struct {
+		key     string
+		blocked string
+	}{
+		{key: clean.Key, blocked: ""},
+		{key: listed.Key, blocked: "host: example.org"},
+		{key: viaFallback.Key, blocked: "host: example.org"},
+	} {
+		sd, err := store.Get(ctx, tt.key)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.blocked, sd.Blocked)
+	}
+
+	// the links already blocked are skipped
+	n, err = s.Scan(ctx, store)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// an invalid list keeps the previous ones
+	if err = os.WriteFile(hosts, []byte("10.0.0.0/33\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, s.Reload())
+	_, ok = s.Check("https://example.org/")
+	assert.True(t, ok)
+}
@@ -0,0 +1,170 @@
+// Package urlnorm validates the URLs submitted to be shortened and rewrites them in a canonical form,
+// so that the different spellings of the same URL are deduplicated
+package urlnorm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/alexadhy/shortener/internal/ipv4"
+)
+
+var (
+	// ErrEmpty is returned for an empty URL
+	ErrEmpty = errors.New("url is empty")
+	// ErrScheme is returned for a relative URL, or one whose scheme isn't allowed, e.g. javascript:
+	ErrScheme = errors.New("url scheme is not allowed")
+	// ErrNoHost is returned for a URL without host
+	ErrNoHost = errors.New("url has no host")
+	// ErrInvalidHost is returned for a host which isn't a valid domain name or IP address
+	ErrInvalidHost = errors.New("url host is not valid")
+	// ErrUserinfo is returned for a URL with a user name or password, e.g. https://example.com@evil.example/
+	// which is mostly used to disguise the host
+	ErrUserinfo = errors.New("url can't have a user name or password")
+)
+
+// DefaultSchemes are the schemes allowed when Options.Schemes is empty
+var DefaultSchemes = []string{"http", "https"}
+
+// defaultPorts are removed from the URLs of their scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// profile converts internationalized domain names to punycode, underscores are allowed as some hosts use them
+var profile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// Options configures a Normalizer
+type Options struct {
+	// Schemes are the allowed schemes, DefaultSchemes if empty
+	Schemes []string
+	// StripFragment removes the fragment, which is never sent to the destination server
+	StripFragment bool
+	// SortQuery sorts the query parameters by name, the order of the values of a parameter is preserved
+	// the query is kept as is otherwise
+	SortQuery bool
+}
+
+// Normalizer validates and canonicalizes URLs, see Normalize
+type Normalizer struct {
+	schemes       map[string]struct{}
+	stripFragment bool
+	sortQuery     bool
+}
+
+// New returns a Normalizer configured by opts
+func New(opts Options) *Normalizer {
+	schemes := opts.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	n := &Normalizer{
+		schemes:       make(map[string]struct{}, len(schemes)),
+		stripFragment: opts.StripFragment,
+		sortQuery:     opts.SortQuery,
+	}
+	for _, s := range schemes {
+		n.schemes[strings.ToLower(s)] = struct{}{}
+	}
+	return n
+}
+
+// Normalize returns the canonical form of raw, or an error wrapping one of ErrEmpty, ErrScheme, ErrNoHost, ErrInvalidHost
+// or ErrUserinfo
+// the scheme and host are lowercased, internationalized hosts converted to punycode, IPv4 hosts written as dotted quads,
+// default ports and empty paths of hierarchical URLs removed, and the fragment and query rewritten according to the Options
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrEmpty
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := n.schemes[u.Scheme]; !ok || u.Scheme == "" {
+		return "", fmt.Errorf("%w: %q", ErrScheme, u.Scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", ErrNoHost
+	}
+	if u.User != nil {
+		return "", ErrUserinfo
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6 literals have to stay bracketed
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+	if n.stripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if n.sortQuery && u.RawQuery != "" {
+		q, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return "", err
+		}
+		// Encode sorts by name
+		u.RawQuery = q.Encode()
+	}
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// normalizeHost returns host lowercased, and converted to punycode if it is an internationalized domain name
+// IPv4 addresses are written as dotted quads whichever way they were spelled, e.g. 127.1 or 0x7f.0.0.1
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", ErrNoHost
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	ascii, err := profile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	if strings.HasPrefix(ascii, ".") || strings.Contains(ascii, "..") {
+		return "", fmt.Errorf("%w: empty label in %q", ErrInvalidHost, host)
+	}
+	ascii = strings.ToLower(ascii)
+	// after the IDNA mapping, fullwidth digits and dots are IPv4 addresses too
+	ip, ok, err := ipv4.Parse(ascii)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidHost, err)
+	}
+	if ok {
+		return ip.String(), nil
+	}
+	return ascii, nil
+}